@@ -1,46 +1,198 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/its-rav/makima/pkg/cache"
-	"github.com/its-rav/makima/pkg/config"
+	conf "github.com/its-rav/makima/pkg/config"
 	"github.com/its-rav/makima/pkg/logger"
+	"github.com/its-rav/makima/pkg/message"
 	"github.com/its-rav/makima/pkg/model"
 	"github.com/its-rav/makima/pkg/twitter"
+	"github.com/redis/go-redis/v9"
 )
 
 func main() {
 	logger.InitLogrusLogger()
 	var log = logger.Log
 
-	var config config.CollectorConfig
+	var config conf.CollectorConfig
 	config.Load()
-	// overrideStreamRules(consumerKey, consumerSecret)
 
-	var getStreamQueryParams twitter.GetStreamQueryParams = twitter.GetStreamQueryParams{
-		TweetFields: []string{"created_at", "attachments", "context_annotations", "entities", "public_metrics", "possibly_sensitive", "referenced_tweets", "source", "withheld"},
-		Expansions:  []string{"author_id", "attachments.media_keys"},
-		UserFields:  []string{"name", "username", "profile_image_url"},
-		MediaFields: []string{"url", "preview_image_url", "public_metrics", "alt_text", "variants"},
+	// stop streaming on SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if config.MetricsAddr != "" {
+		go serveMetrics(ctx, log, config.MetricsAddr)
 	}
 
-	bearerToken := twitter.GetBearerToken(config.Twitter.ConsumerKey, config.Twitter.ConsumerSecret)
+	var getStreamQueryParams twitter.GetStreamQueryParams = twitter.DefaultStreamQueryParams()
+
+	redisClient, err := cache.NewClient(ctx, config.Redis.ConnString)
+	if err != nil {
+		log.Fatal(err, "Failed to connect to Redis")
+	}
 
-	twitter.OnStreamReceived(bearerToken, getStreamQueryParams, func(response twitter.TweetResponse) {
+	// the token cache and the poll checkpoints share the connection of the
+	// broker, which closes it
+	broker, err := message.NewBrokerWithClient(redisClient, config.Redis)
+	if err != nil {
+		redisClient.Close()
+		log.Fatal(err, "Failed to create the message broker")
+	}
+	defer broker.Close()
+
+	publish := func(response twitter.TweetResponse) {
 		data := response.Data
 		log.Infof("[%s] (%s) (%s) New tweet received: %+v", config.ChannelID, data.CreatedAt, time.Now().Format(time.RFC1123), response)
 
-		redisClient := cache.NewClient(config.Redis.ConnString)
+		tags := response.RuleTags()
 
 		var publishMessage model.PublishMessage[twitter.TweetResponse] = model.PublishMessage[twitter.TweetResponse]{
 			Source:      "twitter",
 			Destination: "makima:twitter:consumer",
 			Message:     response,
-			Timestamp:   time.Now(),
+			Extras: map[string]string{
+				twitter.ExtraRuleTags: strings.Join(tags, ","),
+			},
+			Timestamp: time.Now(),
+		}
+
+		for _, channel := range config.TagChannels.Resolve(tags, config.ChannelID) {
+			if err := message.Publish(ctx, broker, channel, publishMessage); err != nil {
+				log.Errorf(err, "[%s] Failed to publish tweet %s", channel, data.TweetID)
+			}
+		}
+	}
+
+	streamOptions := twitter.StreamOptions{
+		Logger:       log,
+		StallTimeout: time.Duration(config.Twitter.StallTimeoutSeconds) * time.Second,
+		OnError: func(streamErr *twitter.StreamError) {
+			log.Error(streamErr, fmt.Sprintf("[%s] Stream error received", config.ChannelID))
+		},
+	}
+
+	if len(config.Replay.Files) > 0 {
+		log.Infof("[%s] Replaying %v at %gx", config.ChannelID, twitter.CaptureFiles(config.Replay.Files), config.Replay.PacingSpeed())
+		err := twitter.Replay(ctx, config.Replay.Files, config.Replay.PacingSpeed(), streamOptions, publish)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			log.Fatal(err, "Replay failed")
+		}
+		log.Infof("[%s] Replay done", config.ChannelID)
+		return
+	}
+
+	client := twitter.NewClientFromConfig(config.Twitter)
+	client.Tokens = twitter.NewTokenProvider(client, config.Twitter, newTokenCache(config, redisClient))
+
+	// fail at startup rather than on the first request
+	if _, err := client.Tokens.Token(ctx); err != nil {
+		log.Fatal(err, "Failed to get a bearer token")
+	}
+
+	switch config.Mode {
+	case conf.CollectorModeSearch:
+		err := runSearch(ctx, log, config, client, redisClient, getStreamQueryParams, publish)
+		if errors.Is(err, context.Canceled) {
+			log.Infof("[%s] Collector stopped", config.ChannelID)
+			return
+		}
+
+		log.Fatal(err, "Search polling stopped")
+	case conf.CollectorModeTimeline:
+		err := runTimeline(ctx, log, config, client, redisClient, getStreamQueryParams, publish)
+		if errors.Is(err, context.Canceled) {
+			log.Infof("[%s] Collector stopped", config.ChannelID)
+			return
+		}
+
+		log.Fatal(err, "Timeline polling stopped")
+	}
+
+	if !reconcileStreamRules(log, config, client) {
+		return
+	}
+
+	if config.Capture.File != "" {
+		capture, err := twitter.NewCaptureWriter(config.Capture.File, config.Capture.MaxBytes, config.Capture.MaxFiles)
+		if err != nil {
+			log.Fatal(err, "Failed to open the capture file")
 		}
+		defer capture.Close()
+
+		streamOptions.Capture = capture
+	}
+
+	err = client.Stream(ctx, getStreamQueryParams, streamOptions, publish)
+
+	if errors.Is(err, context.Canceled) {
+		log.Infof("[%s] Collector stopped", config.ChannelID)
+		return
+	}
+
+	log.Fatal(err, "Stream stopped")
+}
+
+// newTokenCache picks where the issued bearer token is kept between restarts
+func newTokenCache(config conf.CollectorConfig, redisClient *redis.Client) twitter.TokenCache {
+	if config.Twitter.TokenCacheRedisKey != "" && redisClient != nil {
+		return cache.NewTokenCache(redisClient, config.Twitter.TokenCacheRedisKey)
+	}
+
+	if config.Twitter.TokenCacheFile != "" {
+		return twitter.FileTokenCache(config.Twitter.TokenCacheFile)
+	}
+
+	return nil
+}
+
+// buildStreamRules packs the rules declared in the config within the limits
+// of the access tier
+func buildStreamRules(log logger.Logger, config conf.CollectorConfig) []twitter.AddStreamRule {
+	desired, err := twitter.BuildStreamRulesFromConfig(config.StreamRules(), ruleLimits(config), nil)
+	if err != nil {
+		log.Fatal(err, "Invalid stream rules")
+	}
+
+	return desired
+}
+
+func ruleLimits(config conf.CollectorConfig) twitter.RuleLimits {
+	return twitter.RuleLimits{
+		MaxLength: config.Twitter.MaxRuleLength,
+		MaxRules:  config.Twitter.MaxRules,
+	}
+}
+
+// reconcileStreamRules applies the rules declared in the config. With
+// RulesDryRun the plan is only printed and it reports false, the collector
+// stops there.
+func reconcileStreamRules(log logger.Logger, config conf.CollectorConfig, client *twitter.Client) bool {
+	if len(config.StreamRules()) == 0 {
+		log.Infof("[%s] No stream rules configured, keeping the active ones", config.ChannelID)
+		return true
+	}
+
+	plan, err := client.ReconcileStreamRules(config.StreamRules(), ruleLimits(config), config.RulesDryRun)
+	if err != nil {
+		log.Fatal(err, "Failed to reconcile stream rules")
+	}
+
+	if config.RulesDryRun {
+		fmt.Printf("Stream rules plan (dry run):\n%s\n", plan)
+		return false
+	}
 
-		cache.Publish(redisClient, config.ChannelID, publishMessage)
+	log.Infof("[%s] Stream rules reconciled:\n%s", config.ChannelID, plan)
 
-	})
+	return true
 }
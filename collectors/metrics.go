@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"net/http"
+	"time"
+
+	"github.com/its-rav/makima/pkg/logger"
+)
+
+// serveMetrics exposes the expvar metrics on addr under /debug/vars, among
+// them twitter_stream_stalls and twitter_rate_limits, until ctx is cancelled
+func serveMetrics(ctx context.Context, log logger.Logger, addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	log.Infof("Serving metrics on %s/debug/vars", addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Error(err, "Metrics server stopped")
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/its-rav/makima/pkg/cache"
+	conf "github.com/its-rav/makima/pkg/config"
+	"github.com/its-rav/makima/pkg/logger"
+	"github.com/its-rav/makima/pkg/twitter"
+	"github.com/redis/go-redis/v9"
+)
+
+// runSearch polls recent search instead of streaming, for SearchQuery or for
+// the stream rules declared in the config. The active stream rules are left
+// untouched.
+func runSearch(ctx context.Context, log logger.Logger, config conf.CollectorConfig, client *twitter.Client, redisClient *redis.Client, params twitter.GetStreamQueryParams, publish func(response twitter.TweetResponse)) error {
+	var queries []twitter.SearchQuery
+	if config.SearchQuery != "" {
+		queries = []twitter.SearchQuery{{Query: config.SearchQuery}}
+	} else {
+		queries = twitter.SearchQueriesFromRules(buildStreamRules(log, config))
+	}
+
+	if len(queries) == 0 {
+		log.Fatal(errors.New("no search query or stream rules configured"), "Search mode needs something to search")
+	}
+
+	return client.PollSearch(ctx, queries, params, pollOptions(log, config, redisClient), publish)
+}
+
+func pollOptions(log logger.Logger, config conf.CollectorConfig, redisClient *redis.Client) twitter.PollOptions {
+	opts := twitter.PollOptions{
+		Logger:     log,
+		Interval:   time.Duration(config.Poll.IntervalSeconds) * time.Second,
+		MaxResults: config.Poll.MaxResults,
+	}
+	if redisClient != nil {
+		opts.Checkpoints = cache.NewCheckpoints(redisClient, config.Poll.CheckpointKeyPrefix+config.ChannelID+":")
+	}
+
+	return opts
+}
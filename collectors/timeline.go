@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	conf "github.com/its-rav/makima/pkg/config"
+	"github.com/its-rav/makima/pkg/logger"
+	"github.com/its-rav/makima/pkg/twitter"
+	"github.com/redis/go-redis/v9"
+)
+
+// runTimeline polls the timelines of TimelineUsernames and of the accounts of
+// the stream rules, tagged like their rule. Unknown accounts are skipped.
+func runTimeline(ctx context.Context, log logger.Logger, config conf.CollectorConfig, client *twitter.Client, redisClient *redis.Client, params twitter.GetStreamQueryParams, publish func(response twitter.TweetResponse)) error {
+	var users []twitter.TimelineUser
+	for _, username := range config.TimelineUsernames {
+		users = append(users, twitter.TimelineUser{Username: username})
+	}
+	for _, rule := range config.StreamRules() {
+		for _, username := range rule.From {
+			users = append(users, twitter.TimelineUser{Username: username, Tag: rule.Tag})
+		}
+	}
+
+	if len(users) == 0 {
+		log.Fatal(errors.New("no timeline usernames or stream rule accounts configured"), "Timeline mode needs accounts to follow")
+	}
+
+	users, err := client.ResolveTimelineUsers(ctx, users)
+	if err != nil {
+		if len(users) == 0 {
+			return err
+		}
+		log.Warnf("[%s] %v", config.ChannelID, err)
+	}
+
+	return client.PollTimelines(ctx, users, params, pollOptions(log, config, redisClient), publish)
+}
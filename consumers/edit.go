@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/its-rav/makima/pkg/cache"
+	"github.com/its-rav/makima/pkg/discord"
+	"github.com/its-rav/makima/pkg/message"
+	"github.com/its-rav/makima/pkg/twitter"
+)
+
+// editStore keeps the message posted for each tweet, see cache.EditStore
+type editStore interface {
+	Load(ctx context.Context, originalID string) (cache.PostedTweet, bool, error)
+	Store(ctx context.Context, originalID string, posted cache.PostedTweet) error
+}
+
+var edits editStore
+
+// errNoAuthor is returned for messages that cannot be rendered
+var errNoAuthor = message.Permanent(errors.New("no tweet or author in the message"))
+
+// postTweet posts the webhook message, or edits the message posted for an
+// earlier version of the tweet with an edited marker and a diff of the text.
+// A version older than the posted one is skipped.
+func postTweet(ctx context.Context, tweetResponse twitter.TweetResponse, webhookMessage discord.DiscordWebhookMessage) error {
+	data := tweetResponse.Data
+	text := webhookMessage.Embeds[0].Description
+	originalID := data.OriginalID()
+
+	if edits == nil {
+		_, err := sendTweet(ctx, tweetResponse, webhookMessage)
+		return webhookError(err)
+	}
+
+	posted, found, err := edits.Load(ctx, originalID)
+	if err != nil {
+		return fmt.Errorf("load the posted message of tweet %s: %w", originalID, err)
+	}
+
+	if found {
+		// versions delivered again or out of order would undo a later edit
+		if !data.Supersedes(posted.TweetID) {
+			log.Infof("[%s] Tweet %s is not newer than the posted version %s", config.ChannelID, data.TweetID, posted.TweetID)
+			return nil
+		}
+
+		markEdited(&webhookMessage, posted.Text, text)
+		err := discord.EditDiscordWebhookMessage(ctx, config.WebhookURL, posted.MessageID, webhookMessage)
+		if err != nil {
+			return webhookError(fmt.Errorf("edit message %s of tweet %s: %w", posted.MessageID, originalID, err))
+		}
+	} else {
+		created, err := sendTweet(ctx, tweetResponse, webhookMessage)
+		if err != nil {
+			return webhookError(fmt.Errorf("send tweet %s: %w", data.TweetID, err))
+		}
+		posted.MessageID = created.ID
+	}
+
+	// the message is out, retrying would post it twice
+	posted.TweetID = data.TweetID
+	posted.Text = text
+	if err := edits.Store(ctx, originalID, posted); err != nil {
+		log.Errorf(err, "[%s] Failed to store the posted message of tweet %s", config.ChannelID, originalID)
+	}
+
+	return nil
+}
+
+// webhookError marks the requests Discord rejected as permanent failures,
+// only rate limits and server errors are worth retrying
+func webhookError(err error) error {
+	var webhookErr *discord.WebhookError
+	if errors.As(err, &webhookErr) && !webhookErr.Temporary() {
+		return message.Permanent(err)
+	}
+
+	return err
+}
+
+// sendTweet posts a new webhook message, with the tweet video if it has one
+func sendTweet(ctx context.Context, tweetResponse twitter.TweetResponse, webhookMessage discord.DiscordWebhookMessage) (discord.DiscordWebhookResponse, error) {
+	if media, variant, ok := findVideo(tweetResponse); ok {
+		return sendWithVideo(ctx, webhookMessage, media, variant)
+	}
+
+	return discord.ExecuteDiscordWebhookMessage(ctx, config.WebhookURL, webhookMessage)
+}
+
+// markEdited flags the embed as edited and adds the changes to the text
+func markEdited(webhookMessage *discord.DiscordWebhookMessage, oldText string, newText string) {
+	embed := &webhookMessage.Embeds[0]
+	embed.Footer.Text += " · edited"
+
+	if oldText == newText {
+		return
+	}
+
+	embed.Fields = append(embed.Fields, discord.DiscordWebhookEmbedField{
+		Name:  "Edited",
+		Value: truncate(diffWords(oldText, newText), EmbedFieldLimit),
+	})
+}
+
+// diffWords formats the word changes from oldText to newText, removed words
+// are struck through and added ones are bold
+func diffWords(oldText string, newText string) string {
+	a := strings.Fields(oldText)
+	b := strings.Fields(newText)
+
+	// lcs[i][j] is the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var out, removed, added []string
+	flush := func() {
+		if len(removed) > 0 {
+			out = append(out, "~~"+strings.Join(removed, " ")+"~~")
+			removed = nil
+		}
+		if len(added) > 0 {
+			out = append(out, "**"+strings.Join(added, " ")+"**")
+			added = nil
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			flush()
+			out = append(out, a[i])
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			removed = append(removed, a[i])
+			i++
+		default:
+			added = append(added, b[j])
+			j++
+		}
+	}
+	flush()
+
+	return strings.Join(out, " ")
+}
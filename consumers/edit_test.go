@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/its-rav/makima/pkg/cache"
+	"github.com/its-rav/makima/pkg/twitter"
+)
+
+// memoryEdits is an editStore kept in memory
+type memoryEdits map[string]cache.PostedTweet
+
+func (m memoryEdits) Load(ctx context.Context, originalID string) (cache.PostedTweet, bool, error) {
+	posted, ok := m[originalID]
+	return posted, ok, nil
+}
+
+func (m memoryEdits) Store(ctx context.Context, originalID string, posted cache.PostedTweet) error {
+	m[originalID] = posted
+	return nil
+}
+
+// useEdits sets the edit store until the test ends
+func useEdits(t *testing.T, store editStore) {
+	previous := edits
+	edits = store
+	t.Cleanup(func() { edits = previous })
+}
+
+// tweetVersion is version id of tweet 1, edited into the versions of history
+func tweetVersion(id string, text string, history ...string) twitter.TweetResponse {
+	return twitter.TweetResponse{
+		Data: twitter.TweetData{
+			TweetID:             id,
+			AuthorID:            "10",
+			Content:             text,
+			EditHistoryTweetIDs: history,
+		},
+		Includes: twitter.TweetInclude{Users: []twitter.User{{ID: "10", Name: "Alice", Username: "alice"}}},
+	}
+}
+
+func TestDiffWords(t *testing.T) {
+	tests := []struct {
+		old, new string
+		want     string
+	}{
+		{old: "a b c", new: "a b c", want: "a b c"},
+		{old: "a b c", new: "a x c", want: "a ~~b~~ **x** c"},
+		{old: "a b", new: "a b c d", want: "a b **c d**"},
+		{old: "a b c d", new: "c d", want: "~~a b~~ c d"},
+		{old: "", new: "a", want: "**a**"},
+		{old: "a  b\nc", new: "a b c", want: "a b c"},
+	}
+
+	for _, tt := range tests {
+		if got := diffWords(tt.old, tt.new); got != tt.want {
+			t.Errorf("diffWords(%q, %q) = %q, want %q", tt.old, tt.new, got, tt.want)
+		}
+	}
+}
+
+func TestHandleMessageEdits(t *testing.T) {
+	webhook := newWebhookServer(t)
+	store := memoryEdits{}
+	useEdits(t, store)
+
+	versions := []twitter.TweetResponse{
+		tweetVersion("1", "the first version", "1"),
+		tweetVersion("2", "the second version", "1", "2"),
+		// delivered again, then out of order
+		tweetVersion("2", "the second version", "1", "2"),
+		tweetVersion("3", "the third version", "1", "2", "3"),
+		tweetVersion("1", "the first version", "1"),
+		tweetVersion("2", "the second version", "1", "2"),
+	}
+	for _, version := range versions {
+		if err := handle(version); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	requests := webhook.posted()
+	if len(requests) != 3 {
+		t.Fatalf("%d webhook requests, want one message posted and edited twice: %+v", len(requests), requests)
+	}
+	if requests[0].Method != http.MethodPost {
+		t.Errorf("first version sent with %s, want POST", requests[0].Method)
+	}
+	for _, request := range requests[1:] {
+		if request.Method != http.MethodPatch || request.MessageID != "1" {
+			t.Errorf("edit sent with %s to message %q, want PATCH to message 1", request.Method, request.MessageID)
+		}
+		if footer := request.Message.Embeds[0].Footer.Text; !strings.HasSuffix(footer, "edited") {
+			t.Errorf("edited message footer %q, want the edited marker", footer)
+		}
+	}
+
+	last := requests[2].Message.Embeds[0]
+	if last.Description != "the third version" {
+		t.Errorf("last edit shows %q, want the third version", last.Description)
+	}
+	if field := last.Fields[len(last.Fields)-1]; field.Name != "Edited" || field.Value != "the ~~second~~ **third** version" {
+		t.Errorf("last edit field %+v, want the diff from the second version", field)
+	}
+
+	if posted := store["1"]; posted.TweetID != "3" || posted.MessageID != "1" {
+		t.Errorf("stored %+v, want version 3 posted as message 1", posted)
+	}
+}
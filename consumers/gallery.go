@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/its-rav/makima/pkg/discord"
+	"github.com/its-rav/makima/pkg/twitter"
+)
+
+// GalleryLimit is the maximum number of images Discord renders as a gallery
+const GalleryLimit = 4
+
+// applyGallery shows the photos of a tweet as a gallery: Discord merges the
+// images of up to four embeds sharing the same url into the first one
+func applyGallery(webhookMessage *discord.DiscordWebhookMessage, photos []twitter.Media, tweetURL string) {
+	if len(photos) > GalleryLimit {
+		photos = photos[:GalleryLimit]
+	}
+
+	embed := &webhookMessage.Embeds[0]
+	embed.URL = tweetURL
+	embed.Thumbnail = discord.DiscordWebhookEmbedImage{}
+	embed.Image = discord.DiscordWebhookEmbedImage{URL: photos[0].URL}
+
+	for _, photo := range photos[1:] {
+		webhookMessage.Embeds = append(webhookMessage.Embeds, discord.DiscordWebhookEmbed{
+			URL:   tweetURL,
+			Image: discord.DiscordWebhookEmbedImage{URL: photo.URL},
+		})
+	}
+}
+
+// altTextField lists the alt text of the photos by position, embed images
+// have no alt text of their own
+func altTextField(photos []twitter.Media) (discord.DiscordWebhookEmbedField, bool) {
+	var value string
+	for i, photo := range photos {
+		if photo.AltText == "" {
+			continue
+		}
+		value += fmt.Sprintf("**%d**: %s\n", i+1, photo.AltText)
+	}
+
+	if value == "" {
+		return discord.DiscordWebhookEmbedField{}, false
+	}
+
+	return discord.DiscordWebhookEmbedField{
+		Name:  "Alt text",
+		Value: truncate(value, EmbedFieldLimit),
+	}, true
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/its-rav/makima/pkg/twitter"
+)
+
+// photoTweet is a tweet with n photos, the odd ones with alt text
+func photoTweet(n int) twitter.TweetResponse {
+	tweetResponse := twitter.TweetResponse{
+		Data: twitter.TweetData{TweetID: "1", AuthorID: "10", Content: "photos", Attachments: &twitter.Attachments{}},
+		Includes: twitter.TweetInclude{
+			Users: []twitter.User{{ID: "10", Name: "Alice", Username: "alice"}},
+		},
+	}
+	for i := 1; i <= n; i++ {
+		photo := twitter.Media{MediaKey: fmt.Sprintf("3_%d", i), Type: twitter.MediaPhoto, URL: fmt.Sprintf("https://pbs.twimg.com/%d.jpg", i)}
+		if i%2 == 1 {
+			photo.AltText = fmt.Sprintf("photo %d", i)
+		}
+		tweetResponse.Data.Attachments.MediaKeys = append(tweetResponse.Data.Attachments.MediaKeys, photo.MediaKey)
+		tweetResponse.Includes.Media = append(tweetResponse.Includes.Media, photo)
+	}
+
+	return tweetResponse
+}
+
+func TestHandleMessageGallery(t *testing.T) {
+	tests := []struct {
+		photos  int
+		embeds  int
+		altText string
+	}{
+		{photos: 1, embeds: 1, altText: "**1**: photo 1\n"},
+		{photos: 2, embeds: 2, altText: "**1**: photo 1\n"},
+		{photos: 4, embeds: 4, altText: "**1**: photo 1\n**3**: photo 3\n"},
+		// Discord shows four images at most
+		{photos: 6, embeds: 4, altText: "**1**: photo 1\n**3**: photo 3\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d photos", tt.photos), func(t *testing.T) {
+			webhook := newWebhookServer(t)
+			if err := handle(photoTweet(tt.photos)); err != nil {
+				t.Fatal(err)
+			}
+
+			embeds := webhook.posted()[0].Message.Embeds
+			if len(embeds) != tt.embeds {
+				t.Fatalf("%d embeds, want %d", len(embeds), tt.embeds)
+			}
+
+			if tt.photos == 1 {
+				if embeds[0].Thumbnail.URL != "https://pbs.twimg.com/1.jpg" || embeds[0].URL != "" {
+					t.Errorf("single photo shown as %+v, want the thumbnail", embeds[0])
+				}
+			} else {
+				for i, embed := range embeds {
+					if want := fmt.Sprintf("https://pbs.twimg.com/%d.jpg", i+1); embed.Image.URL != want {
+						t.Errorf("embed %d shows %q, want %q", i, embed.Image.URL, want)
+					}
+					if embed.URL != "https://twitter.com/alice/status/1" {
+						t.Errorf("embed %d links %q, want the tweet url shared by the gallery", i, embed.URL)
+					}
+				}
+				if embeds[0].Thumbnail.URL != "" {
+					t.Errorf("gallery keeps the thumbnail %q", embeds[0].Thumbnail.URL)
+				}
+			}
+
+			var altText string
+			for _, field := range embeds[0].Fields {
+				if field.Name == "Alt text" {
+					altText = field.Value
+				}
+			}
+			if altText != tt.altText {
+				t.Errorf("alt text field %q, want %q", altText, tt.altText)
+			}
+		})
+	}
+}
@@ -1,10 +1,17 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/its-rav/makima/pkg/cache"
 	conf "github.com/its-rav/makima/pkg/config"
 	"github.com/its-rav/makima/pkg/discord"
 	logger "github.com/its-rav/makima/pkg/logger"
@@ -17,6 +24,9 @@ const (
 	TwitterLogo = "https://abs.twimg.com/favicons/twitter.2.ico"
 	AppLogo     = "https://static0.gamerantimages.com/wordpress/wp-content/uploads/2022/12/makima-focused-on-gesture.jpg?q=50&fit=contain&w=1140&h=&dpr=1.5"
 	AppName     = "Makima"
+
+	// EmbedFieldLimit is the maximum length of an embed field value
+	EmbedFieldLimit = 1024
 )
 
 var log logger.Logger
@@ -26,21 +36,26 @@ type TweetHandler[TMessage twitter.TweetResponse] struct{}
 
 type TweetParser[TMessage twitter.TweetResponse] struct{}
 
-func (h *TweetHandler[TMessage]) HandleMessage(message model.PublishMessage[twitter.TweetResponse]) {
+func (h *TweetHandler[TMessage]) HandleMessage(ctx context.Context, message model.PublishMessage[twitter.TweetResponse]) error {
 	tweetResponse := message.Message
 	data := tweetResponse.Data
 
-	//  check if tweetResponse.Includes not null
+	// mentioned users, expanded by entities.mentions.username
 	var users string
-	if tweetResponse.Includes.Users != nil && len(tweetResponse.Includes.Users) > 1 {
-		for _, user := range tweetResponse.Includes.Users[1:] {
-			users += fmt.Sprintf("[%s](https://twitter.com/%s)\n ", user.Name, user.Username)
+	for _, mention := range data.Entities.Mentions {
+		name := "@" + mention.Username
+		if user, ok := tweetResponse.UserByID(mention.ID); ok {
+			name = user.Name
 		}
+		users += fmt.Sprintf("[%s](https://twitter.com/%s)\n ", name, mention.Username)
 	}
 
+	// videos and animated GIFs have no URL, their preview image is shown
 	var medias []string
 	for _, media := range tweetResponse.Includes.Media {
-		medias = append(medias, media.URL)
+		if imageURL := media.ImageURL(); imageURL != "" {
+			medias = append(medias, imageURL)
+		}
 	}
 
 	// entities string seperated by comma
@@ -118,7 +133,11 @@ func (h *TweetHandler[TMessage]) HandleMessage(message model.PublishMessage[twit
 		}
 	}
 
-	author := tweetResponse.Includes.Users[0]
+	author, ok := tweetResponse.Author()
+	if data.TweetID == "" || !ok {
+		return errNoAuthor
+	}
+
 	var fields []discord.DiscordWebhookEmbedField = []discord.DiscordWebhookEmbedField{
 		{
 			Name:   "Source",
@@ -127,6 +146,42 @@ func (h *TweetHandler[TMessage]) HandleMessage(message model.PublishMessage[twit
 		},
 	}
 
+	// quoted, replied to and retweeted tweets, expanded by referenced_tweets.id
+	description := data.Content
+	for _, ref := range data.ReferencedTweets {
+		refTweet, ok := tweetResponse.TweetByID(ref.ID)
+		if !ok {
+			continue
+		}
+
+		refAuthor, ok := tweetResponse.UserByID(refTweet.AuthorID)
+		if !ok {
+			refAuthor = twitter.User{Username: "i/web", Name: "Unknown"}
+		}
+		refLink := fmt.Sprintf("[tweet](https://twitter.com/%s/status/%s)", refAuthor.Username, refTweet.TweetID)
+
+		switch ref.Type {
+		case twitter.ReferencedTweetQuoted:
+			fields = append(fields, discord.DiscordWebhookEmbedField{
+				Name:  fmt.Sprintf("Quoting %s (@%s)", refAuthor.Name, refAuthor.Username),
+				Value: truncate(quote(refTweet.Content), EmbedFieldLimit-len(refLink)-1) + "\n" + refLink,
+			})
+		case twitter.ReferencedTweetRepliedTo:
+			fields = append(fields, discord.DiscordWebhookEmbedField{
+				Name:  fmt.Sprintf("Replying to %s (@%s)", refAuthor.Name, refAuthor.Username),
+				Value: truncate(quote(refTweet.Content), EmbedFieldLimit-len(refLink)-1) + "\n" + refLink,
+			})
+		case twitter.ReferencedTweetRetweeted:
+			// the retweet text is truncated, show the original one instead
+			description = refTweet.Content
+			fields = append(fields, discord.DiscordWebhookEmbedField{
+				Name:   "Retweet of",
+				Value:  fmt.Sprintf("[%s (@%s)](https://twitter.com/%s/status/%s)", refAuthor.Name, refAuthor.Username, refAuthor.Username, refTweet.TweetID),
+				Inline: true,
+			})
+		}
+	}
+
 	if users != "" {
 		fields = append(fields, discord.DiscordWebhookEmbedField{
 			Name:   "Mentions",
@@ -151,6 +206,14 @@ func (h *TweetHandler[TMessage]) HandleMessage(message model.PublishMessage[twit
 		})
 	}
 
+	photos := tweetResponse.Photos()
+	if len(photos) > GalleryLimit {
+		photos = photos[:GalleryLimit]
+	}
+	if field, ok := altTextField(photos); ok {
+		fields = append(fields, field)
+	}
+
 	if entityAnnotationsStr != "" {
 		fields = append(fields, discord.DiscordWebhookEmbedField{
 			Name:   "Annotations",
@@ -162,7 +225,7 @@ func (h *TweetHandler[TMessage]) HandleMessage(message model.PublishMessage[twit
 	var webhookMessage = discord.DiscordWebhookMessage{
 		Embeds: []discord.DiscordWebhookEmbed{
 			{
-				Description: data.Content,
+				Description: description,
 				Color:       0x00ACEE,
 				Author: discord.DiscordWebhookEmbedAuthor{
 					Name:    fmt.Sprintf("%s (@%s)", author.Name, author.Username),
@@ -182,7 +245,10 @@ func (h *TweetHandler[TMessage]) HandleMessage(message model.PublishMessage[twit
 		AvatarURL: AppLogo,
 	}
 
-	if medias != nil && len(medias) > 0 {
+	tweetURL := fmt.Sprintf("https://twitter.com/%s/status/%s", author.Username, data.TweetID)
+	if len(photos) > 1 {
+		applyGallery(&webhookMessage, photos, tweetURL)
+	} else if medias != nil && len(medias) > 0 {
 
 		webhookMessage.Embeds[0].Thumbnail = discord.DiscordWebhookEmbedImage{
 			URL: medias[0],
@@ -197,14 +263,25 @@ func (h *TweetHandler[TMessage]) HandleMessage(message model.PublishMessage[twit
 
 	log.Infof("[%s] (%s) (%s) Webhook message sent: %+v", config.ChannelID, data.CreatedAt, time.Now().Format(time.RFC1123), webhookMessage)
 
-	// send message to discord webhook
-	discord.SendDiscordWebhookMessage(
-		config.WebhookURL,
-		webhookMessage,
-	)
+	return postTweet(ctx, tweetResponse, webhookMessage)
+}
+
+// quote formats text as a Discord block quote
+func quote(text string) string {
+	return "> " + strings.ReplaceAll(text, "\n", "\n> ")
 }
 
-func (p *TweetParser[TMessage]) ParseMessage(raw string) model.PublishMessage[twitter.TweetResponse] {
+// truncate shortens text to at most limit characters
+func truncate(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
+	}
+
+	return string(runes[:limit-1]) + "…"
+}
+
+func (p *TweetParser[TMessage]) ParseMessage(raw string) (model.PublishMessage[twitter.TweetResponse], error) {
 	var message model.PublishMessage[twitter.TweetResponse]
 
 	err := json.Unmarshal([]byte(raw), &message)
@@ -212,7 +289,22 @@ func (p *TweetParser[TMessage]) ParseMessage(raw string) model.PublishMessage[tw
 		log.Errorf(err, "[%s] Error while parsing message.", config.ChannelID)
 	}
 
-	return message
+	return message, err
+}
+
+// partitionByAuthor keeps the tweets of an author in order, an edit is never
+// handled before the tweet it edits
+func partitionByAuthor(delivery message.Delivery) string {
+	var partial struct {
+		Message struct {
+			Data struct {
+				AuthorID string `json:"author_id"`
+			} `json:"data"`
+		}
+	}
+	json.Unmarshal([]byte(delivery.Payload), &partial)
+
+	return partial.Message.Data.AuthorID
 }
 
 func main() {
@@ -224,14 +316,48 @@ func main() {
 
 	fmt.Printf("[%s] Starting consumer...", config.ChannelID)
 
+	// stop listening on SIGINT/SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// without Redis edits are posted as new messages
+	if config.Redis.ConnString != "" {
+		redisClient, err := cache.NewClient(ctx, config.Redis.ConnString)
+		if err != nil {
+			log.Fatal(err, "Failed to connect to Redis")
+		}
+		defer redisClient.Close()
+
+		edits = cache.NewEditStore(
+			redisClient,
+			config.EditKeyPrefix+config.ChannelID+":",
+			time.Duration(config.EditTTLSeconds)*time.Second,
+		)
+	}
+
 	l := message.NewListener[twitter.TweetResponse](
 		message.ListenerConfig{
-			Redis:   config.Redis,
-			Channel: config.ChannelID,
+			Redis:           config.Redis,
+			Channel:         config.ChannelID,
+			Logger:          log,
+			MaxAttempts:     config.Retry.MaxAttempts,
+			InitialBackoff:  time.Duration(config.Retry.InitialBackoffMs) * time.Millisecond,
+			MaxBackoff:      time.Duration(config.Retry.MaxBackoffMs) * time.Millisecond,
+			DeadLetter:      config.DeadLetterChannel,
+			Workers:         config.Workers,
+			PartitionKey:    partitionByAuthor,
+			QueueSize:       config.QueueSize,
+			ShutdownTimeout: time.Duration(config.ShutdownTimeoutSeconds) * time.Second,
 		},
 		&TweetHandler[twitter.TweetResponse]{},
 		&TweetParser[twitter.TweetResponse]{},
 	)
 
-	l.Listen()
+	err := l.Listen(ctx)
+	if errors.Is(err, context.Canceled) {
+		log.Infof("[%s] Consumer stopped", config.ChannelID)
+		return
+	}
+
+	log.Fatal(err, "Listener stopped")
 }
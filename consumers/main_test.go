@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/its-rav/makima/pkg/discord"
+	"github.com/its-rav/makima/pkg/logger"
+	"github.com/its-rav/makima/pkg/message"
+	"github.com/its-rav/makima/pkg/model"
+	"github.com/its-rav/makima/pkg/twitter"
+)
+
+func TestMain(m *testing.M) {
+	log = logger.NopLogger{}
+	os.Exit(m.Run())
+}
+
+// webhookRequest is a message posted or edited through the webhook
+type webhookRequest struct {
+	Method    string
+	MessageID string
+	Message   discord.DiscordWebhookMessage
+	// Files are the names of the attached files
+	Files []string
+}
+
+// webhookServer is a fake Discord webhook, messages are created with ids
+// counting from 1
+type webhookServer struct {
+	mu       sync.Mutex
+	requests []webhookRequest
+}
+
+// newWebhookServer points config.WebhookURL to a fake webhook until the test
+// ends
+func newWebhookServer(t *testing.T) *webhookServer {
+	t.Helper()
+
+	s := &webhookServer{}
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+
+	webhookURL := config.WebhookURL
+	config.WebhookURL = server.URL + "/api/webhooks/1/token"
+	t.Cleanup(func() { config.WebhookURL = webhookURL })
+
+	return s
+}
+
+func (s *webhookServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	request := webhookRequest{Method: r.Method}
+	if _, messageID, ok := strings.Cut(r.URL.Path, "/messages/"); ok {
+		request.MessageID = messageID
+	}
+
+	var payload io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, files := range r.MultipartForm.File {
+			for _, file := range files {
+				request.Files = append(request.Files, file.Filename)
+			}
+		}
+		payload = strings.NewReader(r.FormValue("payload_json"))
+	}
+	if err := json.NewDecoder(payload).Decode(&request.Message); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, request)
+	id := len(s.requests)
+	s.mu.Unlock()
+
+	if r.Method == http.MethodPatch {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	json.NewEncoder(w).Encode(discord.DiscordWebhookResponse{ID: fmt.Sprint(id)})
+}
+
+// posted returns the requests received so far
+func (s *webhookServer) posted() []webhookRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]webhookRequest(nil), s.requests...)
+}
+
+func handle(tweetResponse twitter.TweetResponse) error {
+	handler := &TweetHandler[twitter.TweetResponse]{}
+	return handler.HandleMessage(context.Background(), model.PublishMessage[twitter.TweetResponse]{Message: tweetResponse})
+}
+
+func TestHandleMessageWithoutAuthor(t *testing.T) {
+	tests := []struct {
+		name          string
+		tweetResponse twitter.TweetResponse
+	}{
+		{
+			name:          "no users expanded",
+			tweetResponse: twitter.TweetResponse{Data: twitter.TweetData{TweetID: "1", AuthorID: "10", Content: "tweet"}},
+		},
+		{
+			name: "author not expanded",
+			tweetResponse: twitter.TweetResponse{
+				Data:     twitter.TweetData{TweetID: "1", AuthorID: "10", Content: "tweet"},
+				Includes: twitter.TweetInclude{Users: []twitter.User{{ID: "11", Username: "other"}}},
+			},
+		},
+		{
+			name:          "error object",
+			tweetResponse: twitter.TweetResponse{Errors: []twitter.APIError{{Title: "operational-disconnect"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := handle(tt.tweetResponse); !message.IsPermanent(err) {
+				t.Errorf("HandleMessage returned %v, want a permanent error", err)
+			}
+		})
+	}
+}
+
+func TestHandleMessageReferencedTweets(t *testing.T) {
+	webhook := newWebhookServer(t)
+
+	err := handle(twitter.TweetResponse{
+		Data: twitter.TweetData{
+			TweetID:  "1",
+			AuthorID: "10",
+			Content:  "agreed",
+			ReferencedTweets: []twitter.ReferencedTweet{
+				{Type: twitter.ReferencedTweetQuoted, ID: "2"},
+				{Type: twitter.ReferencedTweetRepliedTo, ID: "3"},
+				// not expanded, skipped
+				{Type: twitter.ReferencedTweetQuoted, ID: "4"},
+			},
+		},
+		Includes: twitter.TweetInclude{
+			Users: []twitter.User{{ID: "10", Name: "Alice", Username: "alice"}, {ID: "11", Name: "Bob", Username: "bob"}},
+			Tweets: []twitter.TweetData{
+				{TweetID: "2", AuthorID: "11", Content: "first line\nsecond line"},
+				{TweetID: "3", AuthorID: "12", Content: strings.Repeat("a", 2*EmbedFieldLimit)},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requests := webhook.posted()
+	if len(requests) != 1 {
+		t.Fatalf("%d webhook requests, want 1", len(requests))
+	}
+	embed := requests[0].Message.Embeds[0]
+	if embed.Description != "agreed" || embed.Author.Name != "Alice (@alice)" {
+		t.Errorf("embed by %q reads %q, want the tweet of Alice", embed.Author.Name, embed.Description)
+	}
+
+	fields := make(map[string]string)
+	for _, field := range embed.Fields {
+		fields[field.Name] = field.Value
+	}
+
+	if quoted := fields["Quoting Bob (@bob)"]; quoted != "> first line\n> second line\n[tweet](https://twitter.com/bob/status/2)" {
+		t.Errorf("quoted field %q, want the quoted text and link", quoted)
+	}
+
+	// the author of tweet 3 was not expanded
+	replied, ok := fields["Replying to Unknown (@i/web)"]
+	if !ok || !strings.HasSuffix(replied, "…\n[tweet](https://twitter.com/i/web/status/3)") {
+		t.Errorf("replied field %q, want the truncated text and link", replied)
+	}
+	if n := len([]rune(replied)); n > EmbedFieldLimit {
+		t.Errorf("replied field is %d characters, over the %d limit", n, EmbedFieldLimit)
+	}
+}
+
+func TestHandleMessageRetweet(t *testing.T) {
+	webhook := newWebhookServer(t)
+
+	err := handle(twitter.TweetResponse{
+		Data: twitter.TweetData{
+			TweetID:          "1",
+			AuthorID:         "10",
+			Content:          "RT @bob: the original text, trunc…",
+			ReferencedTweets: []twitter.ReferencedTweet{{Type: twitter.ReferencedTweetRetweeted, ID: "2"}},
+		},
+		Includes: twitter.TweetInclude{
+			Users:  []twitter.User{{ID: "10", Name: "Alice", Username: "alice"}, {ID: "11", Name: "Bob", Username: "bob"}},
+			Tweets: []twitter.TweetData{{TweetID: "2", AuthorID: "11", Content: "the original text, truncated in the retweet"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	embed := webhook.posted()[0].Message.Embeds[0]
+	if embed.Description != "the original text, truncated in the retweet" {
+		t.Errorf("retweet reads %q, want the original text", embed.Description)
+	}
+
+	found := false
+	for _, field := range embed.Fields {
+		found = found || (field.Name == "Retweet of" && field.Value == "[Bob (@bob)](https://twitter.com/bob/status/2)")
+	}
+	if !found {
+		t.Errorf("fields %+v, want a link to the retweeted tweet", embed.Fields)
+	}
+}
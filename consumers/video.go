@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+
+	"github.com/its-rav/makima/pkg/discord"
+	"github.com/its-rav/makima/pkg/twitter"
+)
+
+const (
+	VideoModeLink   = "link"
+	VideoModeAttach = "attach"
+
+	// DefaultMaxVideoBytes is the upload limit of a Discord webhook
+	DefaultMaxVideoBytes = 8 << 20
+)
+
+func maxVideoBytes() int64 {
+	if config.MaxVideoBytes <= 0 {
+		return DefaultMaxVideoBytes
+	}
+
+	return config.MaxVideoBytes
+}
+
+// findVideo returns the first video or animated GIF of the tweet along with
+// its best MP4 variant under the configured size
+func findVideo(tweetResponse twitter.TweetResponse) (twitter.Media, twitter.MediaVariant, bool) {
+	for _, media := range tweetResponse.Includes.Media {
+		if !media.IsVideo() {
+			continue
+		}
+
+		if variant, ok := media.BestVariant(maxVideoBytes()); ok {
+			return media, variant, true
+		}
+	}
+
+	return twitter.Media{}, twitter.MediaVariant{}, false
+}
+
+// downloadVideo fetches a video variant, failing when it is larger than maxBytes
+func downloadVideo(ctx context.Context, url string, maxBytes int64) (discord.DiscordWebhookFile, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return discord.DiscordWebhookFile{}, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return discord.DiscordWebhookFile{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return discord.DiscordWebhookFile{}, fmt.Errorf("unexpected response %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return discord.DiscordWebhookFile{}, err
+	}
+
+	if int64(len(data)) > maxBytes {
+		return discord.DiscordWebhookFile{}, fmt.Errorf("video is larger than %d bytes", maxBytes)
+	}
+
+	return discord.DiscordWebhookFile{
+		Name:        path.Base(resp.Request.URL.Path),
+		ContentType: "video/mp4",
+		Data:        data,
+	}, nil
+}
+
+// sendWithVideo posts the webhook message with the video attached in attach
+// mode, or linked in the message content which Discord renders as a player
+func sendWithVideo(ctx context.Context, webhookMessage discord.DiscordWebhookMessage, media twitter.Media, variant twitter.MediaVariant) (discord.DiscordWebhookResponse, error) {
+	if config.VideoMode == VideoModeAttach {
+		file, err := downloadVideo(ctx, variant.URL, maxVideoBytes())
+		if err == nil {
+			var created discord.DiscordWebhookResponse
+			created, err = discord.SendDiscordWebhookMessageWithFiles(ctx, config.WebhookURL, webhookMessage, []discord.DiscordWebhookFile{file})
+			if err == nil {
+				return created, nil
+			}
+		}
+
+		log.Errorf(err, "[%s] Failed to attach video %s, linking it instead", config.ChannelID, media.MediaKey)
+	}
+
+	webhookMessage.Content = variant.URL
+	return discord.ExecuteDiscordWebhookMessage(ctx, config.WebhookURL, webhookMessage)
+}
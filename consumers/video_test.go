@@ -0,0 +1,124 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/its-rav/makima/pkg/twitter"
+)
+
+// useVideoConfig sets the video mode and size limit until the test ends
+func useVideoConfig(t *testing.T, mode string, maxBytes int64) {
+	videoMode, maxVideoBytes := config.VideoMode, config.MaxVideoBytes
+	config.VideoMode, config.MaxVideoBytes = mode, maxBytes
+	t.Cleanup(func() { config.VideoMode, config.MaxVideoBytes = videoMode, maxVideoBytes })
+}
+
+// newVideoServer serves size bytes for every path
+func newVideoServer(t *testing.T, size int) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, size))
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// videoTweet is a 10s video whose 256kbps variant weighs 320kB and 2Mbps
+// variant 2.5MB
+func videoTweet(videoURL string) twitter.TweetResponse {
+	return twitter.TweetResponse{
+		Data: twitter.TweetData{TweetID: "1", AuthorID: "10", Content: "watch this"},
+		Includes: twitter.TweetInclude{
+			Users: []twitter.User{{ID: "10", Name: "Alice", Username: "alice"}},
+			Media: []twitter.Media{{
+				MediaKey:        "7_1",
+				Type:            twitter.MediaVideo,
+				DurationMS:      10000,
+				PreviewImageURL: "https://pbs.twimg.com/preview.jpg",
+				Variants: []twitter.MediaVariant{
+					{BitRate: 256000, ContentType: "video/mp4", URL: videoURL + "/256.mp4"},
+					{BitRate: 2176000, ContentType: "video/mp4", URL: videoURL + "/2176.mp4"},
+					{ContentType: "application/x-mpegURL", URL: videoURL + "/playlist.m3u8"},
+				},
+			}},
+		},
+	}
+}
+
+func TestHandleMessageVideo(t *testing.T) {
+	videos := newVideoServer(t, 1000)
+
+	tests := []struct {
+		name     string
+		mode     string
+		maxBytes int64
+		content  string
+		files    []string
+	}{
+		{name: "link", mode: VideoModeLink, content: videos.URL + "/2176.mp4"},
+		{name: "link under the limit", mode: VideoModeLink, maxBytes: 1 << 20, content: videos.URL + "/256.mp4"},
+		{name: "attach", mode: VideoModeAttach, files: []string{"2176.mp4"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			webhook := newWebhookServer(t)
+			useVideoConfig(t, tt.mode, tt.maxBytes)
+
+			if err := handle(videoTweet(videos.URL)); err != nil {
+				t.Fatal(err)
+			}
+
+			requests := webhook.posted()
+			if len(requests) != 1 {
+				t.Fatalf("%d webhook requests, want 1", len(requests))
+			}
+			request := requests[0]
+			if request.Message.Content != tt.content || !reflect.DeepEqual(request.Files, tt.files) {
+				t.Errorf("posted content %q with files %v, want %q with %v", request.Message.Content, request.Files, tt.content, tt.files)
+			}
+			if thumbnail := request.Message.Embeds[0].Thumbnail.URL; thumbnail != "https://pbs.twimg.com/preview.jpg" {
+				t.Errorf("thumbnail %q, want the preview image", thumbnail)
+			}
+		})
+	}
+}
+
+func TestHandleMessageVideoAttachFallback(t *testing.T) {
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+	large := newVideoServer(t, 2<<20)
+
+	tests := []struct {
+		name     string
+		videoURL string
+		maxBytes int64
+		content  string
+	}{
+		{name: "download failed", videoURL: missing.URL, content: missing.URL + "/2176.mp4"},
+		// the estimate of the 256kbps variant fits but the download does not
+		{name: "download too large", videoURL: large.URL, maxBytes: 1 << 20, content: large.URL + "/256.mp4"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			webhook := newWebhookServer(t)
+			useVideoConfig(t, VideoModeAttach, tt.maxBytes)
+
+			if err := handle(videoTweet(tt.videoURL)); err != nil {
+				t.Fatal(err)
+			}
+
+			requests := webhook.posted()
+			if len(requests) != 1 {
+				t.Fatalf("%d webhook requests, want 1", len(requests))
+			}
+			if request := requests[0]; request.Message.Content != tt.content || len(request.Files) != 0 {
+				t.Errorf("posted content %q with files %v, want the link %q", request.Message.Content, request.Files, tt.content)
+			}
+		})
+	}
+}
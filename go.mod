@@ -2,12 +2,14 @@ module github.com/its-rav/makima
 
 go 1.20
 
-require github.com/redis/go-redis/v9 v9.0.3
+require (
+	github.com/caarlos0/env/v8 v8.0.0
+	github.com/redis/go-redis/v9 v9.0.3
+	github.com/sirupsen/logrus v1.9.0
+)
 
 require (
-	github.com/caarlos0/env/v8 v8.0.0 // indirect
 	github.com/cespare/xxhash/v2 v2.2.0 // indirect
 	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
-	github.com/sirupsen/logrus v1.9.0 // indirect
 	golang.org/x/sys v0.0.0-20220715151400-c0bba94af5f8 // indirect
 )
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/its-rav/makima/pkg/cache"
+	"github.com/its-rav/makima/pkg/config"
+	"github.com/its-rav/makima/pkg/message"
+	"github.com/redis/go-redis/v9"
+)
+
+const dlqUsage = `usage: makima dlq <subcommand> [flags]
+
+subcommands:
+  list [-count n]               list the dead letters, oldest first
+  requeue [-all] [<id>...]      publish dead letters back to their channel
+  purge [-all] [<id>...]        delete dead letters
+
+every subcommand accepts -channel to pick the dead-letter stream, the one of
+the consumer configuration by default, and list accepts -json.
+with the pubsub transport requeued messages only reach running consumers.`
+
+// dlqFlags are shared by the dlq subcommands
+type dlqFlags struct {
+	flags   *flag.FlagSet
+	channel *string
+	all     *bool
+}
+
+func newDLQFlags(name string, cfg config.ConsumerConfig) dlqFlags {
+	listener := message.ListenerConfig{
+		Channel:    cfg.ChannelID,
+		DeadLetter: cfg.DeadLetterChannel,
+	}
+
+	flags := flag.NewFlagSet("dlq "+name, flag.ExitOnError)
+	return dlqFlags{
+		flags:   flags,
+		channel: flags.String("channel", listener.DeadLetterChannel(), "dead-letter stream"),
+		all:     flags.Bool("all", false, "apply to every dead letter"),
+	}
+}
+
+func runDLQ(args []string) error {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, dlqUsage)
+		return errors.New("missing subcommand")
+	}
+
+	subcommands := map[string]func(ctx context.Context, cfg config.ConsumerConfig, args []string) error{
+		"list":    dlqList,
+		"requeue": dlqRequeue,
+		"purge":   dlqPurge,
+	}
+
+	run, ok := subcommands[args[0]]
+	if !ok {
+		fmt.Fprintln(os.Stderr, dlqUsage)
+		return fmt.Errorf("unknown subcommand %q", args[0])
+	}
+
+	var cfg config.ConsumerConfig
+	cfg.Load()
+
+	return run(context.Background(), cfg, args[1:])
+}
+
+// deadLetterEntry is a dead letter along with its id in the dead-letter stream
+type deadLetterEntry struct {
+	EntryID string `json:"entryId"`
+	message.DeadLetter
+}
+
+// loadDeadLetters reads the dead letters of stream, keeping the given entry
+// ids unless all is set
+func loadDeadLetters(ctx context.Context, client *redis.Client, stream string, count int64, ids []string, all bool) ([]deadLetterEntry, error) {
+	entries, err := cache.RangeStream(ctx, client, stream, count)
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[string]bool)
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	var deadLetters []deadLetterEntry
+	for _, entry := range entries {
+		if !all && len(ids) > 0 && !wanted[entry.ID] {
+			continue
+		}
+
+		deadLetter, err := message.ParseDeadLetter(entry.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("entry %s: %w", entry.ID, err)
+		}
+		deadLetters = append(deadLetters, deadLetterEntry{EntryID: entry.ID, DeadLetter: deadLetter})
+	}
+
+	return deadLetters, nil
+}
+
+func dlqList(ctx context.Context, cfg config.ConsumerConfig, args []string) error {
+	f := newDLQFlags("list", cfg)
+	count := f.flags.Int64("count", 100, "maximum number of dead letters")
+	asJSON := f.flags.Bool("json", false, "print JSON")
+	f.flags.Parse(args)
+
+	client, err := cache.NewClient(ctx, cfg.Redis.ConnString)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	deadLetters, err := loadDeadLetters(ctx, client, *f.channel, *count, nil, true)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return printJSON(deadLetters)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tFAILED AT\tATTEMPTS\tCHANNEL\tERROR")
+	for _, deadLetter := range deadLetters {
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", deadLetter.EntryID, deadLetter.FailedAt.Format("2006-01-02 15:04:05"), deadLetter.Attempts, deadLetter.Channel, deadLetter.Error)
+	}
+
+	return w.Flush()
+}
+
+func dlqRequeue(ctx context.Context, cfg config.ConsumerConfig, args []string) error {
+	f := newDLQFlags("requeue", cfg)
+	f.flags.Parse(args)
+
+	if !*f.all && f.flags.NArg() == 0 {
+		return errors.New("expected dead letter ids or -all")
+	}
+
+	client, err := cache.NewClient(ctx, cfg.Redis.ConnString)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	deadLetters, err := loadDeadLetters(ctx, client, *f.channel, 0, f.flags.Args(), *f.all)
+	if err != nil {
+		return err
+	}
+
+	broker, err := message.NewBroker(ctx, cfg.Redis)
+	if err != nil {
+		return err
+	}
+	defer broker.Close()
+
+	for _, deadLetter := range deadLetters {
+		if err := broker.Publish(ctx, deadLetter.Channel, []byte(deadLetter.Payload)); err != nil {
+			return err
+		}
+		// dropped only once back on its channel, a failure leaves it listed
+		if err := cache.DeleteStream(ctx, client, *f.channel, deadLetter.EntryID); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("%d requeued\n", len(deadLetters))
+
+	return nil
+}
+
+func dlqPurge(ctx context.Context, cfg config.ConsumerConfig, args []string) error {
+	f := newDLQFlags("purge", cfg)
+	f.flags.Parse(args)
+
+	if !*f.all && f.flags.NArg() == 0 {
+		return errors.New("expected dead letter ids or -all")
+	}
+
+	client, err := cache.NewClient(ctx, cfg.Redis.ConnString)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	deadLetters, err := loadDeadLetters(ctx, client, *f.channel, 0, f.flags.Args(), *f.all)
+	if err != nil {
+		return err
+	}
+
+	var ids []string
+	for _, deadLetter := range deadLetters {
+		ids = append(ids, deadLetter.EntryID)
+	}
+
+	if len(ids) > 0 {
+		if err := cache.DeleteStream(ctx, client, *f.channel, ids...); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("%d purged\n", len(ids))
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+
+	"github.com/its-rav/makima/pkg/twitter/twittertest"
+)
+
+// runFakeTwitter serves the fake Twitter API until the process is stopped,
+// point the collector at it with TWITTER_BASE_URL
+func runFakeTwitter(args []string) error {
+	flags := flag.NewFlagSet("fake-twitter", flag.ExitOnError)
+	addr := flags.String("addr", "127.0.0.1:8089", "listen address")
+	fixtures := flags.String("fixtures", "", "JSONL file of stream payloads to replay")
+	interval := flags.Duration("interval", twittertest.DefaultInterval, "delay between replayed tweets")
+	keepAlive := flags.Duration("keep-alive", twittertest.DefaultKeepAlive, "delay between keep-alives")
+	loop := flags.Bool("loop", false, "replay the fixtures forever")
+	token := flags.String("token", twittertest.DefaultBearerToken, "bearer token issued and accepted by the server")
+	flags.Parse(args)
+
+	opts := twittertest.Options{
+		BearerToken: *token,
+		Interval:    *interval,
+		KeepAlive:   *keepAlive,
+		Loop:        *loop,
+	}
+
+	if *fixtures != "" {
+		tweets, err := twittertest.LoadFixtures(*fixtures)
+		if err != nil {
+			return err
+		}
+		opts.Tweets = tweets
+	}
+
+	fmt.Printf("fake twitter listening on http://%s, %d fixture(s)\n", *addr, len(opts.Tweets))
+	fmt.Println("inject faults with POST /fake/disconnect, /fake/malformed, /fake/send,")
+	fmt.Println("/fake/fail?status=429&count=1 and /fake/keepalive?pause=true")
+
+	return http.ListenAndServe(*addr, twittertest.New(opts).Handler())
+}
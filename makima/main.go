@@ -0,0 +1,73 @@
+// makima is the command line companion of the collector and consumer
+//
+//	makima dlq <list|requeue|purge> [flags]
+//	makima rules <list|add|delete|sync|validate> [flags]
+//	makima token <check|invalidate>
+//	makima fake-twitter [-addr addr] [-fixtures file.jsonl]
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+)
+
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"dlq": {
+		usage: "inspect, requeue or purge dead-lettered messages",
+		run:   runDLQ,
+	},
+	"fake-twitter": {
+		usage: "serve a fake Twitter API for local development",
+		run:   runFakeTwitter,
+	},
+	"rules": {
+		usage: "manage the filtered stream rules",
+		run:   runRules,
+	},
+	"token": {
+		usage: "check or invalidate the bearer token",
+		run:   runToken,
+	},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: makima <command> [arguments]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "commands:")
+
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-14s %s\n", name, commands[name].usage)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "makima: unknown command %q\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+
+	if err := cmd.run(os.Args[2:]); err != nil {
+		fmt.Fprintf(os.Stderr, "makima %s: %v\n", os.Args[1], err)
+		os.Exit(1)
+	}
+}
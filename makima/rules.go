@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/its-rav/makima/pkg/config"
+	"github.com/its-rav/makima/pkg/twitter"
+)
+
+const rulesUsage = `usage: makima rules <subcommand> [flags]
+
+subcommands:
+  list                          list the active rules
+  add [-tag tag] <value>        add a rule
+  delete <id>...                delete rules by id
+  sync [-dry-run] <file>        make the active rules match a JSON rules file
+  validate [-tag tag] <value>   check a rule with the API without adding it
+
+every subcommand accepts -json to print the raw result as JSON`
+
+func runRules(args []string) error {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, rulesUsage)
+		return errors.New("missing subcommand")
+	}
+
+	subcommands := map[string]func(args []string) error{
+		"list":     rulesList,
+		"add":      rulesAdd,
+		"delete":   rulesDelete,
+		"sync":     rulesSync,
+		"validate": rulesValidate,
+	}
+
+	run, ok := subcommands[args[0]]
+	if !ok {
+		fmt.Fprintln(os.Stderr, rulesUsage)
+		return fmt.Errorf("unknown subcommand %q", args[0])
+	}
+
+	return run(args[1:])
+}
+
+func loadCollectorConfig() config.CollectorConfig {
+	var cfg config.CollectorConfig
+	cfg.Load()
+
+	return cfg
+}
+
+// newTwitterClient returns an authenticated client for the collector
+// configuration, only the file token cache is shared with the collector
+func newTwitterClient(cfg config.CollectorConfig) *twitter.Client {
+	var tokenCache twitter.TokenCache
+	if cfg.Twitter.TokenCacheFile != "" {
+		tokenCache = twitter.FileTokenCache(cfg.Twitter.TokenCacheFile)
+	}
+
+	client := twitter.NewClientFromConfig(cfg.Twitter)
+	client.Tokens = twitter.NewTokenProvider(client, cfg.Twitter, tokenCache)
+
+	return client
+}
+
+func rulesList(args []string) error {
+	flags := flag.NewFlagSet("rules list", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "print JSON")
+	flags.Parse(args)
+
+	resp, err := newTwitterClient(loadCollectorConfig()).GetStreamRules()
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return printJSON(resp)
+	}
+
+	return printRules(resp.Data)
+}
+
+func rulesAdd(args []string) error {
+	flags := flag.NewFlagSet("rules add", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "print JSON")
+	tag := flags.String("tag", "", "rule tag")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return errors.New("expected exactly one rule value")
+	}
+
+	resp, err := newTwitterClient(loadCollectorConfig()).AddStreamRules([]twitter.AddStreamRule{
+		{
+			Value: flags.Arg(0),
+			Tag:   *tag,
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return printJSON(resp)
+	}
+
+	return printRules(resp.Data)
+}
+
+func rulesDelete(args []string) error {
+	flags := flag.NewFlagSet("rules delete", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "print JSON")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		return errors.New("expected at least one rule id")
+	}
+
+	resp, err := newTwitterClient(loadCollectorConfig()).DeleteStreamRules(flags.Args())
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return printJSON(resp)
+	}
+
+	fmt.Printf("%d deleted, %d not deleted\n", resp.Meta.Summary.Deleted, resp.Meta.Summary.NotDeleted)
+
+	return nil
+}
+
+func rulesSync(args []string) error {
+	flags := flag.NewFlagSet("rules sync", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "print JSON")
+	dryRun := flags.Bool("dry-run", false, "print the plan without applying it")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return errors.New("expected a rules file")
+	}
+
+	ruleConfigs, err := config.LoadStreamRulesFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	cfg := loadCollectorConfig()
+	plan, err := newTwitterClient(cfg).ReconcileStreamRules(ruleConfigs, twitter.RuleLimits{
+		MaxLength: cfg.Twitter.MaxRuleLength,
+		MaxRules:  cfg.Twitter.MaxRules,
+	}, *dryRun)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return printJSON(plan)
+	}
+
+	fmt.Println(plan)
+
+	return nil
+}
+
+func rulesValidate(args []string) error {
+	flags := flag.NewFlagSet("rules validate", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "print JSON")
+	tag := flags.String("tag", "", "rule tag")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return errors.New("expected exactly one rule value")
+	}
+
+	resp, err := newTwitterClient(loadCollectorConfig()).ValidateStreamRules([]twitter.AddStreamRule{
+		{
+			Value: flags.Arg(0),
+			Tag:   *tag,
+		},
+	})
+
+	var rulesErr *twitter.RulesError
+	if err != nil && !errors.As(err, &rulesErr) {
+		return err
+	}
+
+	if *asJSON {
+		if printErr := printJSON(resp); printErr != nil {
+			return printErr
+		}
+		return err
+	}
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d valid, %d invalid\n", resp.Meta.Summary.Valid, resp.Meta.Summary.Invalid)
+
+	return nil
+}
+
+func printRules(rules []twitter.StreamRule) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTAG\tVALUE")
+	for _, rule := range rules {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", rule.ID, rule.Tag, rule.Value)
+	}
+
+	return w.Flush()
+}
+
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(v)
+}
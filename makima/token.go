@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+const tokenUsage = `usage: makima token <subcommand>
+
+subcommands:
+  check        request the stream rules to check that the bearer token is accepted
+  invalidate   revoke the cached bearer token and clear the token cache`
+
+func runToken(args []string) error {
+	if len(args) < 1 {
+		fmt.Fprintln(os.Stderr, tokenUsage)
+		return errors.New("missing subcommand")
+	}
+
+	flags := flag.NewFlagSet("token "+args[0], flag.ExitOnError)
+	flags.Parse(args[1:])
+
+	ctx := context.Background()
+	client := newTwitterClient(loadCollectorConfig())
+
+	switch args[0] {
+	case "check":
+		// a token is only known to work once the API accepted it
+		if _, err := client.GetStreamRules(); err != nil {
+			return err
+		}
+		fmt.Println("bearer token ok")
+	case "invalidate":
+		if err := client.Tokens.Invalidate(ctx); err != nil {
+			return err
+		}
+		fmt.Println("bearer token invalidated")
+	default:
+		fmt.Fprintln(os.Stderr, tokenUsage)
+		return fmt.Errorf("unknown subcommand %q", args[0])
+	}
+
+	return nil
+}
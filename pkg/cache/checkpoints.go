@@ -0,0 +1,34 @@
+package cache
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Checkpoints keeps the newest tweet ID seen by the pollers under Prefix+key,
+// it satisfies twitter.Checkpoints
+type Checkpoints struct {
+	Client *redis.Client
+	Prefix string
+}
+
+func NewCheckpoints(client *redis.Client, prefix string) *Checkpoints {
+	return &Checkpoints{
+		Client: client,
+		Prefix: prefix,
+	}
+}
+
+func (c *Checkpoints) Load(ctx context.Context, key string) (string, error) {
+	id, err := c.Client.Get(ctx, c.Prefix+key).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+
+	return id, err
+}
+
+func (c *Checkpoints) Store(ctx context.Context, key string, id string) error {
+	return c.Client.Set(ctx, c.Prefix+key, id, 0).Err()
+}
@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// PostedTweet is the Discord message posted for the latest version of a tweet
+type PostedTweet struct {
+	MessageID string `json:"messageId"`
+	TweetID   string `json:"tweetId"`
+	Text      string `json:"text"`
+}
+
+// DefaultEditTTL is how long the message of a tweet is kept for its edits
+const DefaultEditTTL = 24 * time.Hour
+
+// EditStore maps original tweet IDs to their posted Discord message, entries
+// expire after TTL, DefaultEditTTL when zero
+type EditStore struct {
+	Client *redis.Client
+	Prefix string
+	TTL    time.Duration
+}
+
+func NewEditStore(client *redis.Client, prefix string, ttl time.Duration) *EditStore {
+	return &EditStore{
+		Client: client,
+		Prefix: prefix,
+		TTL:    ttl,
+	}
+}
+
+func (s *EditStore) Load(ctx context.Context, originalID string) (PostedTweet, bool, error) {
+	var posted PostedTweet
+
+	raw, err := s.Client.Get(ctx, s.Prefix+originalID).Bytes()
+	if err == redis.Nil {
+		return posted, false, nil
+	}
+	if err != nil {
+		return posted, false, err
+	}
+
+	if err := json.Unmarshal(raw, &posted); err != nil {
+		return posted, false, err
+	}
+
+	return posted, true, nil
+}
+
+func (s *EditStore) Store(ctx context.Context, originalID string, posted PostedTweet) error {
+	raw, err := json.Marshal(posted)
+	if err != nil {
+		return err
+	}
+
+	return s.Client.Set(ctx, s.Prefix+originalID, raw, s.ttl()).Err()
+}
+
+func (s *EditStore) ttl() time.Duration {
+	if s.TTL <= 0 {
+		return DefaultEditTTL
+	}
+
+	return s.TTL
+}
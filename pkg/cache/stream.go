@@ -0,0 +1,159 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// streamPayloadField holds the JSON message of a stream entry
+	streamPayloadField = "payload"
+
+	DefaultStreamBlock = 5 * time.Second
+	DefaultStreamCount = 10
+)
+
+// StreamMessage is an entry read from a stream, it stays pending in the
+// consumer group until acknowledged
+type StreamMessage struct {
+	ID      string
+	Payload string
+}
+
+// StreamGroup identifies a consumer of a stream consumer group. Entries left
+// pending by a crashed consumer for more than ClaimMinIdle are claimed by the
+// other consumers of the group.
+type StreamGroup struct {
+	Stream       string
+	Group        string
+	Consumer     string
+	ClaimMinIdle time.Duration
+}
+
+// AddStream appends payload to stream, keeping about maxLen entries when
+// maxLen is positive
+func AddStream(ctx context.Context, client *redis.Client, stream string, maxLen int64, payload []byte) error {
+	return client.XAdd(ctx, &redis.XAddArgs{
+		Stream: stream,
+		MaxLen: maxLen,
+		Approx: true,
+		Values: map[string]interface{}{streamPayloadField: string(payload)},
+	}).Err()
+}
+
+// CreateStreamGroup creates the consumer group and the stream if needed, a
+// new group starts with the entries already in the stream
+func CreateStreamGroup(ctx context.Context, client *redis.Client, group StreamGroup) error {
+	err := client.XGroupCreateMkStream(ctx, group.Stream, group.Group, "0").Err()
+	if err != nil && strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil
+	}
+
+	return err
+}
+
+// ReadStream reads up to count entries for the consumer, waiting up to block,
+// or not at all when block is negative. id ">" reads new entries, "0" the
+// ones already delivered to the consumer and not acknowledged.
+func ReadStream(ctx context.Context, client *redis.Client, group StreamGroup, id string, count int64, block time.Duration) ([]StreamMessage, error) {
+	streams, err := client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    group.Group,
+		Consumer: group.Consumer,
+		Streams:  []string{group.Stream, id},
+		Count:    count,
+		Block:    block,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var messages []StreamMessage
+	for _, stream := range streams {
+		messages = append(messages, toStreamMessages(stream.Messages)...)
+	}
+
+	return messages, nil
+}
+
+// ClaimStream takes over the entries pending for longer than ClaimMinIdle,
+// scanning from start, "0-0" for the first page. The returned cursor is
+// empty once the scan is over. Entries still being handled have to be kept
+// from going idle with TouchStream.
+func ClaimStream(ctx context.Context, client *redis.Client, group StreamGroup, start string, count int64) ([]StreamMessage, string, error) {
+	entries, next, err := client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   group.Stream,
+		Group:    group.Group,
+		Consumer: group.Consumer,
+		MinIdle:  group.ClaimMinIdle,
+		Start:    start,
+		Count:    count,
+	}).Result()
+	if err != nil {
+		return nil, "", err
+	}
+
+	if next == "0-0" {
+		next = ""
+	}
+
+	return toStreamMessages(entries), next, nil
+}
+
+// TouchStream resets the idle time of entries pending on the consumer, so
+// that the other consumers do not claim the ones still being handled
+func TouchStream(ctx context.Context, client *redis.Client, group StreamGroup, ids ...string) error {
+	return client.XClaimJustID(ctx, &redis.XClaimArgs{
+		Stream:   group.Stream,
+		Group:    group.Group,
+		Consumer: group.Consumer,
+		Messages: ids,
+	}).Err()
+}
+
+// AckStream acknowledges entries, they are no longer pending
+func AckStream(ctx context.Context, client *redis.Client, group StreamGroup, ids ...string) error {
+	return client.XAck(ctx, group.Stream, group.Group, ids...).Err()
+}
+
+// RangeStream returns up to count entries of stream, all of them when count
+// is not positive, oldest first, without reading them as a consumer
+func RangeStream(ctx context.Context, client *redis.Client, stream string, count int64) ([]StreamMessage, error) {
+	var cmd *redis.XMessageSliceCmd
+	if count > 0 {
+		cmd = client.XRangeN(ctx, stream, "-", "+", count)
+	} else {
+		cmd = client.XRange(ctx, stream, "-", "+")
+	}
+
+	entries, err := cmd.Result()
+	if err != nil {
+		return nil, err
+	}
+
+	return toStreamMessages(entries), nil
+}
+
+// DeleteStream removes entries from stream
+func DeleteStream(ctx context.Context, client *redis.Client, stream string, ids ...string) error {
+	return client.XDel(ctx, stream, ids...).Err()
+}
+
+func toStreamMessages(entries []redis.XMessage) []StreamMessage {
+	var messages []StreamMessage
+	for _, entry := range entries {
+		payload, _ := entry.Values[streamPayloadField].(string)
+		messages = append(messages, StreamMessage{
+			ID:      entry.ID,
+			Payload: payload,
+		})
+	}
+
+	return messages
+}
@@ -0,0 +1,37 @@
+package cache
+
+import (
+	"context"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// TokenCache keeps a bearer token under Key, it satisfies twitter.TokenCache
+type TokenCache struct {
+	Client *redis.Client
+	Key    string
+}
+
+func NewTokenCache(client *redis.Client, key string) *TokenCache {
+	return &TokenCache{
+		Client: client,
+		Key:    key,
+	}
+}
+
+func (c *TokenCache) Load(ctx context.Context) (string, error) {
+	token, err := c.Client.Get(ctx, c.Key).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+
+	return token, err
+}
+
+func (c *TokenCache) Store(ctx context.Context, token string) error {
+	return c.Client.Set(ctx, c.Key, token, 0).Err()
+}
+
+func (c *TokenCache) Clear(ctx context.Context) error {
+	return c.Client.Del(ctx, c.Key).Err()
+}
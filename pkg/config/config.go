@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/caarlos0/env/v8"
 )
@@ -79,6 +80,96 @@ func (cfg *CollectorConfig) Load() {
 	}
 }
 
+// StreamRules returns the rules declared inline followed by the ones of RulesFile
+func (cfg *CollectorConfig) StreamRules() []StreamRuleConfig {
+	rules := append([]StreamRuleConfig{}, cfg.Rules...)
+
+	if cfg.RulesFile != "" {
+		fileRules, err := LoadStreamRulesFile(cfg.RulesFile)
+		if err != nil {
+			processError(err)
+		}
+		rules = append(rules, fileRules...)
+	}
+
+	return rules
+}
+
+// LoadStreamRulesFile reads a JSON array of stream rules
+func LoadStreamRulesFile(fileName string) ([]StreamRuleConfig, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules []StreamRuleConfig
+	if err := json.NewDecoder(f).Decode(&rules); err != nil {
+		return nil, fmt.Errorf("%s: %w", fileName, err)
+	}
+
+	return rules, nil
+}
+
+// TagChannels maps rule tags to channel ids, channel ids contain colons so
+// the environment uses "tag=channel" pairs
+type TagChannels map[string]string
+
+func (t *TagChannels) UnmarshalText(text []byte) error {
+	channels := make(TagChannels)
+	for _, pair := range strings.Split(string(text), ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		tag, channel, ok := strings.Cut(pair, "=")
+		if !ok || tag == "" || channel == "" {
+			return fmt.Errorf("tag channel %q should be in \"tag=channel\" format", pair)
+		}
+		channels[tag] = channel
+	}
+
+	*t = channels
+
+	return nil
+}
+
+func (t *TagChannels) UnmarshalJSON(data []byte) error {
+	var channels map[string]string
+	if err := json.Unmarshal(data, &channels); err != nil {
+		return err
+	}
+
+	*t = channels
+
+	return nil
+}
+
+// Resolve returns the distinct channels of tags, fallback is used for tags
+// without a channel and when there is no tag at all
+func (t TagChannels) Resolve(tags []string, fallback string) []string {
+	if len(tags) == 0 {
+		return []string{fallback}
+	}
+
+	var channels []string
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		channel, ok := t[tag]
+		if !ok {
+			channel = fallback
+		}
+		if seen[channel] {
+			continue
+		}
+		seen[channel] = true
+		channels = append(channels, channel)
+	}
+
+	return channels
+}
+
 func (cfg *BaseLoggerConfig) FromFile(fileName string) {
 	f, err := os.Open(fileName)
 	if err != nil {
@@ -1,14 +1,44 @@
 package config
 
+const (
+	TransportPubSub  = "pubsub"
+	TransportStreams = "streams"
+)
+
 type RedisConfig struct {
 	ConnString string `json:"connectionString" env:"CONN_STRING"`
 	Password   string `json:"password" env:"PASSWORD"`
 	DB         int    `json:"db" env:"DB"`
+	// Transport is "pubsub", where messages published while no consumer
+	// listens are lost, or "streams" for durable delivery to consumer groups
+	Transport string `json:"transport" env:"TRANSPORT" envDefault:"pubsub"`
+	// StreamMaxLen is the approximate number of entries kept in a stream
+	StreamMaxLen int64 `json:"streamMaxLen" env:"STREAM_MAX_LEN" envDefault:"10000"`
+	// StreamGroup and StreamConsumer identify the consumer, the hostname is
+	// used when StreamConsumer is empty
+	StreamGroup    string `json:"streamGroup" env:"STREAM_GROUP" envDefault:"makima"`
+	StreamConsumer string `json:"streamConsumer" env:"STREAM_CONSUMER"`
+	// StreamClaimIdleSeconds is how long an entry stays pending on a crashed
+	// consumer before another one takes it over
+	StreamClaimIdleSeconds int `json:"streamClaimIdleSeconds" env:"STREAM_CLAIM_IDLE_SECONDS" envDefault:"60"`
 }
 
 type TwitterConfig struct {
 	ConsumerKey    string `json:"consumerKey" env:"CONSUMER_KEY"`
 	ConsumerSecret string `json:"consumerSecret" env:"CONSUMER_SECRET"`
+	// BearerToken is a pre-issued token used instead of the consumer key and secret
+	BearerToken string `json:"bearerToken" env:"BEARER_TOKEN"`
+	// TokenCacheFile and TokenCacheRedisKey keep the issued token between restarts
+	TokenCacheFile     string `json:"tokenCacheFile" env:"TOKEN_CACHE_FILE"`
+	TokenCacheRedisKey string `json:"tokenCacheRedisKey" env:"TOKEN_CACHE_REDIS_KEY"`
+	// BaseURL and UserAgent override the API endpoint, e.g. for a local fake server
+	BaseURL   string `json:"baseUrl" env:"BASE_URL"`
+	UserAgent string `json:"userAgent" env:"USER_AGENT"`
+	// StallTimeoutSeconds is the silence window before the stream reconnects
+	StallTimeoutSeconds int `json:"stallTimeoutSeconds" env:"STALL_TIMEOUT_SECONDS" envDefault:"30"`
+	// MaxRuleLength and MaxRules are the limits of the access tier
+	MaxRuleLength int `json:"maxRuleLength" env:"MAX_RULE_LENGTH" envDefault:"512"`
+	MaxRules      int `json:"maxRules" env:"MAX_RULES" envDefault:"5"`
 }
 
 type LoggerConfig struct {
@@ -24,6 +54,82 @@ type ConsumerConfig struct {
 	ChannelID  string       `json:"channelId" env:"CHANNEL_ID"`
 	WebhookURL string       `json:"webhookUrl" env:"WEBHOOK_URL"`
 	Logger     LoggerConfig `json:"logger" envPrefix:"LOGGER_"`
+	// VideoMode is "link" to post the preview image and a direct video link,
+	// or "attach" to upload the video when it fits in MaxVideoBytes
+	VideoMode     string `json:"videoMode" env:"VIDEO_MODE" envDefault:"link"`
+	MaxVideoBytes int64  `json:"maxVideoBytes" env:"MAX_VIDEO_BYTES" envDefault:"8388608"`
+	// EditKeyPrefix and EditTTLSeconds keep the Discord message of each tweet
+	// so that its later edits update it instead of posting again
+	EditKeyPrefix  string      `json:"editKeyPrefix" env:"EDIT_KEY_PREFIX" envDefault:"makima:edits:"`
+	EditTTLSeconds int         `json:"editTtlSeconds" env:"EDIT_TTL_SECONDS" envDefault:"86400"`
+	Retry          RetryConfig `json:"retry" envPrefix:"RETRY_"`
+	// DeadLetterChannel is the Redis stream of the messages that failed for
+	// good, the channel followed by ":dlq" when empty
+	DeadLetterChannel string `json:"deadLetterChannel" env:"DEAD_LETTER_CHANNEL"`
+	// Workers post tweets concurrently, the tweets of an author stay in order.
+	// QueueSize tweets wait for each worker before reading is held back.
+	Workers   int `json:"workers" env:"WORKERS" envDefault:"4"`
+	QueueSize int `json:"queueSize" env:"QUEUE_SIZE" envDefault:"16"`
+	// ShutdownTimeoutSeconds is how long the tweets being posted are waited
+	// for on SIGINT/SIGTERM
+	ShutdownTimeoutSeconds int `json:"shutdownTimeoutSeconds" env:"SHUTDOWN_TIMEOUT_SECONDS" envDefault:"8"`
+}
+
+// RetryConfig is the retry schedule of failing messages, delays double from
+// InitialBackoffMs up to MaxBackoffMs
+type RetryConfig struct {
+	MaxAttempts      int `json:"maxAttempts" env:"MAX_ATTEMPTS" envDefault:"5"`
+	InitialBackoffMs int `json:"initialBackoffMs" env:"INITIAL_BACKOFF_MS" envDefault:"1000"`
+	MaxBackoffMs     int `json:"maxBackoffMs" env:"MAX_BACKOFF_MS" envDefault:"60000"`
+}
+
+// CaptureConfig tees the raw stream bytes to File when set
+type CaptureConfig struct {
+	File     string `json:"file" env:"FILE"`
+	MaxBytes int64  `json:"maxBytes" env:"MAX_BYTES" envDefault:"104857600"`
+	MaxFiles int    `json:"maxFiles" env:"MAX_FILES" envDefault:"5"`
+}
+
+// ReplayConfig replays captures instead of streaming, Files are the capture
+// files as configured in CaptureConfig, their rotated files are replayed too
+type ReplayConfig struct {
+	Files []string `json:"files" env:"FILES" envSeparator:","`
+	// Speed scales the original pacing, 1 when zero, a negative speed
+	// replays without waiting
+	Speed float64 `json:"speed" env:"SPEED" envDefault:"1"`
+}
+
+// PacingSpeed returns the speed to pass to twitter.Replay
+func (cfg ReplayConfig) PacingSpeed() float64 {
+	if cfg.Speed == 0 {
+		return 1
+	}
+
+	return cfg.Speed
+}
+
+// StreamRuleConfig declares a filtered stream rule, either a raw Value or a
+// list of accounts packed into as few rules as the length limit allows
+type StreamRuleConfig struct {
+	Value string   `json:"value"`
+	Tag   string   `json:"tag"`
+	From  []string `json:"from"`
+}
+
+const (
+	CollectorModeStream   = "stream"
+	CollectorModeSearch   = "search"
+	CollectorModeTimeline = "timeline"
+)
+
+// PollConfig tunes the polling collectors, since_id checkpoints are kept in
+// Redis under CheckpointKeyPrefix
+type PollConfig struct {
+	IntervalSeconds int `json:"intervalSeconds" env:"INTERVAL_SECONDS" envDefault:"60"`
+	// MaxResults is the page size, from 10 to 100 in search mode and from 5
+	// in timeline mode
+	MaxResults          int    `json:"maxResults" env:"MAX_RESULTS" envDefault:"100"`
+	CheckpointKeyPrefix string `json:"checkpointKeyPrefix" env:"CHECKPOINT_KEY_PREFIX" envDefault:"makima:checkpoints:"`
 }
 
 type CollectorConfig struct {
@@ -31,4 +137,25 @@ type CollectorConfig struct {
 	ChannelID string        `json:"channelId" env:"CHANNEL_ID"`
 	Twitter   TwitterConfig `json:"twitter" envPrefix:"TWITTER_"`
 	Logger    LoggerConfig  `json:"logger" envPrefix:"LOGGER_"`
+	// Rules and the rules listed in RulesFile are reconciled with the active
+	// stream rules at startup, nothing is changed when both are empty
+	Rules       []StreamRuleConfig `json:"rules"`
+	RulesFile   string             `json:"rulesFile" env:"RULES_FILE"`
+	RulesDryRun bool               `json:"rulesDryRun" env:"RULES_DRY_RUN"`
+	// TagChannels publishes tweets matching a rule tag to another channel
+	// than ChannelID, "tag=channel,tag=channel" in the environment
+	TagChannels TagChannels   `json:"tagChannels" env:"TAG_CHANNELS"`
+	Capture     CaptureConfig `json:"capture" envPrefix:"CAPTURE_"`
+	Replay      ReplayConfig  `json:"replay" envPrefix:"REPLAY_"`
+	// Mode is "stream" for the filtered stream, "search" to poll recent
+	// search for SearchQuery, or for the stream rules when it is empty, and
+	// "timeline" to poll the timelines of TimelineUsernames and of the
+	// accounts listed in the "from" of the stream rules
+	Mode              string     `json:"mode" env:"MODE" envDefault:"stream"`
+	SearchQuery       string     `json:"searchQuery" env:"SEARCH_QUERY"`
+	TimelineUsernames []string   `json:"timelineUsernames" env:"TIMELINE_USERNAMES" envSeparator:","`
+	Poll              PollConfig `json:"poll" envPrefix:"POLL_"`
+	// MetricsAddr serves the stall and rate limit metrics under /debug/vars,
+	// e.g. ":9100", they are not served when empty
+	MetricsAddr string `json:"metricsAddr" env:"METRICS_ADDR"`
 }
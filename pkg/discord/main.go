@@ -2,10 +2,15 @@ package discord
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"mime/multipart"
 	"net/http"
+	"net/textproto"
+	"net/url"
 )
 
 // {
@@ -73,46 +78,188 @@ type DiscordWebhookEmbed struct {
 	Footer      DiscordWebhookEmbedFooter  `json:"footer,omitempty"`
 }
 
+type DiscordWebhookAttachment struct {
+	ID          int    `json:"id"`
+	Filename    string `json:"filename"`
+	Description string `json:"description,omitempty"`
+}
+
 type DiscordWebhookMessage struct {
-	Content    string                `json:"content,omitempty"`
-	Username   string                `json:"username,omitempty"`
-	AvatarURL  string                `json:"avatar_url,omitempty"`
-	Embeds     []DiscordWebhookEmbed `json:"embeds,omitempty"`
-	Flags      int                   `json:"flags,omitempty"`
-	ThreadName string                `json:"thread_name,omitempty"`
+	Content     string                     `json:"content,omitempty"`
+	Attachments []DiscordWebhookAttachment `json:"attachments,omitempty"`
+	Username    string                     `json:"username,omitempty"`
+	AvatarURL   string                     `json:"avatar_url,omitempty"`
+	Embeds      []DiscordWebhookEmbed      `json:"embeds,omitempty"`
+	Flags       int                        `json:"flags,omitempty"`
+	ThreadName  string                     `json:"thread_name,omitempty"`
+}
+
+// DiscordWebhookFile is a file uploaded along a webhook message
+type DiscordWebhookFile struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// DiscordWebhookResponse is the message created by a webhook executed with wait=true
+type DiscordWebhookResponse struct {
+	ID        string `json:"id"`
+	ChannelID string `json:"channel_id"`
+	Content   string `json:"content"`
+	Timestamp string `json:"timestamp"`
+}
+
+// WebhookError is returned for a webhook request Discord did not accept
+type WebhookError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *WebhookError) Error() string {
+	return fmt.Sprintf("discord: unexpected response %s: %s", e.Status, e.Body)
 }
 
-func SendDiscordWebhookMessage(webhookUrl string, message DiscordWebhookMessage) {
-	// init http client
-	httpClient := &http.Client{}
+// Temporary reports whether the request may succeed later, when rate limited
+// or when Discord fails
+func (e *WebhookError) Temporary() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
 
-	// init request
-	req, err := http.NewRequest("POST", webhookUrl, nil)
+// webhookURL appends path to the webhook url, keeping its query (e.g. thread_id)
+func webhookURL(webhookUrl string, path string, query url.Values) (string, error) {
+	u, err := url.Parse(webhookUrl)
 	if err != nil {
-		// handle error
-		fmt.Println(err)
+		return "", err
 	}
 
-	// set headers
-	req.Header.Set("Content-type", "application/json")
+	u.Path += path
+	q := u.Query()
+	for key, values := range query {
+		q[key] = values
+	}
+	u.RawQuery = q.Encode()
 
-	// set body
-	data := message
+	return u.String(), nil
+}
 
-	bodyBytes, err := json.Marshal(data)
+// doWebhookRequest sends a webhook request and decodes the returned message
+// into out when it is not nil
+func doWebhookRequest(ctx context.Context, method string, target string, contentType string, body io.Reader, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
 	if err != nil {
-		// handle error
-		fmt.Println(err)
+		return err
 	}
+	req.Header.Set("Content-type", contentType)
 
-	req.Body = ioutil.NopCloser(bytes.NewBuffer(bodyBytes))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := ioutil.ReadAll(resp.Body)
+		return &WebhookError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Body:       string(respBody),
+		}
+	}
 
-	resp, err := httpClient.Do(req)
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
 
+// ExecuteDiscordWebhookMessage posts message and waits for Discord to return
+// the created message, whose ID is needed to edit it later
+func ExecuteDiscordWebhookMessage(ctx context.Context, webhookUrl string, message DiscordWebhookMessage) (DiscordWebhookResponse, error) {
+	var created DiscordWebhookResponse
+
+	target, err := webhookURL(webhookUrl, "", url.Values{"wait": {"true"}})
 	if err != nil {
-		// print error
-		fmt.Println(err)
+		return created, err
 	}
 
-	defer resp.Body.Close()
+	bodyBytes, err := json.Marshal(message)
+	if err != nil {
+		return created, err
+	}
+
+	err = doWebhookRequest(ctx, http.MethodPost, target, "application/json", bytes.NewReader(bodyBytes), &created)
+	return created, err
+}
+
+// EditDiscordWebhookMessage replaces the content and embeds of a message
+// previously sent by the webhook, existing attachments are kept
+func EditDiscordWebhookMessage(ctx context.Context, webhookUrl string, messageID string, message DiscordWebhookMessage) error {
+	target, err := webhookURL(webhookUrl, "/messages/"+messageID, nil)
+	if err != nil {
+		return err
+	}
+
+	// username and avatar cannot be changed by an edit
+	message.Username = ""
+	message.AvatarURL = ""
+
+	bodyBytes, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	return doWebhookRequest(ctx, http.MethodPatch, target, "application/json", bytes.NewReader(bodyBytes), nil)
+}
+
+// SendDiscordWebhookMessageWithFiles posts message as multipart form data with
+// files attached, they can be referenced from embeds as attachment://name
+func SendDiscordWebhookMessageWithFiles(ctx context.Context, webhookUrl string, message DiscordWebhookMessage, files []DiscordWebhookFile) (DiscordWebhookResponse, error) {
+	var created DiscordWebhookResponse
+
+	for i, file := range files {
+		message.Attachments = append(message.Attachments, DiscordWebhookAttachment{
+			ID:       i,
+			Filename: file.Name,
+		})
+	}
+
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return created, err
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	if err := writer.WriteField("payload_json", string(payload)); err != nil {
+		return created, err
+	}
+
+	for i, file := range files {
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="files[%d]"; filename="%s"`, i, file.Name))
+		header.Set("Content-Type", file.ContentType)
+
+		part, err := writer.CreatePart(header)
+		if err != nil {
+			return created, err
+		}
+		if _, err := part.Write(file.Data); err != nil {
+			return created, err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return created, err
+	}
+
+	target, err := webhookURL(webhookUrl, "", url.Values{"wait": {"true"}})
+	if err != nil {
+		return created, err
+	}
+
+	err = doWebhookRequest(ctx, http.MethodPost, target, writer.FormDataContentType(), &body, &created)
+	return created, err
 }
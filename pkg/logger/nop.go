@@ -0,0 +1,16 @@
+package logger
+
+// NopLogger discards everything, used when no logger is configured
+type NopLogger struct{}
+
+func (l NopLogger) Fields(data Fields) Logger                         { return l }
+func (l NopLogger) Debug(msg string)                                  {}
+func (l NopLogger) Debugf(msg string, args ...interface{})            {}
+func (l NopLogger) Info(msg string)                                   {}
+func (l NopLogger) Infof(msg string, args ...interface{})             {}
+func (l NopLogger) Warn(msg string)                                   {}
+func (l NopLogger) Warnf(msg string, args ...interface{})             {}
+func (l NopLogger) Error(err error, msg string)                       {}
+func (l NopLogger) Errorf(err error, msg string, args ...interface{}) {}
+func (l NopLogger) Fatal(err error, msg string)                       {}
+func (l NopLogger) Fatalf(err error, msg string, args ...interface{}) {}
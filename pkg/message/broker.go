@@ -0,0 +1,78 @@
+package message
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/its-rav/makima/pkg/cache"
+	"github.com/its-rav/makima/pkg/config"
+	"github.com/its-rav/makima/pkg/model"
+	"github.com/redis/go-redis/v9"
+)
+
+// Delivery is a raw message received from a broker
+type Delivery struct {
+	// ID identifies the message for Ack, empty when the broker has no ids
+	ID      string
+	Channel string
+	Payload string
+}
+
+// Broker carries messages from the collectors to the consumers. Messages
+// received through Subscribe are acknowledged with Ack once handled, brokers
+// without delivery guarantees ignore acknowledgements.
+type Broker interface {
+	Publish(ctx context.Context, channel string, payload []byte) error
+	// Subscribe delivers the messages of channel until ctx is cancelled or
+	// the broker is closed, the returned channel is closed then
+	Subscribe(ctx context.Context, channel string) (<-chan Delivery, error)
+	Ack(ctx context.Context, delivery Delivery) error
+	Close() error
+}
+
+// Publish marshals message and publishes it to channel
+func Publish[T any](ctx context.Context, broker Broker, channel string, message model.PublishMessage[T]) error {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+
+	return broker.Publish(ctx, channel, payload)
+}
+
+// NewBroker connects to Redis and returns the broker of the configured
+// transport
+func NewBroker(ctx context.Context, cfg config.RedisConfig) (Broker, error) {
+	client, err := cache.NewClient(ctx, cfg.ConnString)
+	if err != nil {
+		return nil, err
+	}
+
+	broker, err := NewBrokerWithClient(client, cfg)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return broker, nil
+}
+
+// NewBrokerWithClient returns the broker of the configured transport on an
+// existing connection, which the broker closes along with itself
+func NewBrokerWithClient(client *redis.Client, cfg config.RedisConfig) (Broker, error) {
+	switch cfg.Transport {
+	case config.TransportStreams:
+		return NewRedisStreamsBroker(client, RedisStreamsOptions{
+			Group:        cfg.StreamGroup,
+			Consumer:     cfg.StreamConsumer,
+			MaxLen:       cfg.StreamMaxLen,
+			ClaimMinIdle: time.Duration(cfg.StreamClaimIdleSeconds) * time.Second,
+		}), nil
+	case config.TransportPubSub, "":
+		return NewRedisPubSubBroker(client), nil
+	}
+
+	return nil, fmt.Errorf("unknown transport %q", cfg.Transport)
+}
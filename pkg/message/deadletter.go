@@ -0,0 +1,83 @@
+package message
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+const (
+	DefaultMaxAttempts    = 5
+	DefaultInitialBackoff = time.Second
+	DefaultMaxBackoff     = time.Minute
+	// DeadLetterSuffix is appended to the channel to name its dead-letter
+	// channel when none is configured
+	DeadLetterSuffix = ":dlq"
+)
+
+// DeadLetter is a message that could not be handled, written to the
+// dead-letter stream with the last error
+type DeadLetter struct {
+	// ID is the id of the message on its channel, if the broker has ids
+	ID       string    `json:"id,omitempty"`
+	Channel  string    `json:"channel"`
+	Payload  string    `json:"payload"`
+	Error    string    `json:"error"`
+	Attempts int       `json:"attempts"`
+	FailedAt time.Time `json:"failedAt"`
+}
+
+// deadLetterWriter is implemented by the brokers, the Redis ones add dead
+// letters to a stream whatever their transport so that they can be inspected
+// and requeued with makima dlq
+type deadLetterWriter interface {
+	WriteDeadLetter(ctx context.Context, stream string, payload []byte) error
+}
+
+// ParseDeadLetter decodes an entry of a dead-letter stream
+func ParseDeadLetter(raw string) (DeadLetter, error) {
+	var deadLetter DeadLetter
+	err := json.Unmarshal([]byte(raw), &deadLetter)
+
+	return deadLetter, err
+}
+
+// DeadLetterChannel returns the configured dead-letter channel of the
+// listener, the channel followed by DeadLetterSuffix by default
+func (c *ListenerConfig) DeadLetterChannel() string {
+	if c.DeadLetter != "" {
+		return c.DeadLetter
+	}
+
+	return c.Channel + DeadLetterSuffix
+}
+
+// backoff returns the delay before the retry following attempt
+func (c *ListenerConfig) backoff(attempt int) time.Duration {
+	initial := c.InitialBackoff
+	if initial <= 0 {
+		initial = DefaultInitialBackoff
+	}
+	max := c.MaxBackoff
+	if max <= 0 {
+		max = DefaultMaxBackoff
+	}
+
+	wait := initial
+	for i := 1; i < attempt && wait < max; i++ {
+		wait *= 2
+	}
+	if wait > max {
+		wait = max
+	}
+
+	return wait
+}
+
+func (c *ListenerConfig) maxAttempts() int {
+	if c.MaxAttempts <= 0 {
+		return DefaultMaxAttempts
+	}
+
+	return c.MaxAttempts
+}
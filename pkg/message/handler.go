@@ -1,13 +1,48 @@
 package message
 
 import (
+	"context"
+	"errors"
+
 	"github.com/its-rav/makima/pkg/model"
 )
 
+// MessageHandler handles a parsed message, returned errors are retried
+// unless wrapped with Permanent. ctx is cancelled when the listener gives up
+// waiting for the handlers on shutdown.
 type MessageHandler[TMessage any] interface {
-	HandleMessage(message model.PublishMessage[TMessage])
+	HandleMessage(ctx context.Context, message model.PublishMessage[TMessage]) error
 }
 
+// MessageParser parses a raw message, parse errors are never retried
 type MessageParser[TMessage any] interface {
-	ParseMessage(raw string) model.PublishMessage[TMessage]
+	ParseMessage(raw string) (model.PublishMessage[TMessage], error)
+}
+
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// Permanent marks err as a failure that retrying cannot fix, the message is
+// dead-lettered right away
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
 }
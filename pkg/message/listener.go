@@ -1,17 +1,56 @@
 package message
 
 import (
-	"github.com/its-rav/makima/pkg/cache"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
 	"github.com/its-rav/makima/pkg/config"
+	"github.com/its-rav/makima/pkg/logger"
 )
 
 type ListenerConfig struct {
 	Channel string
 	Redis   config.RedisConfig
+	// Broker to listen on, created from Redis when nil
+	Broker Broker
+	// Logger receives retries and dead letters, discarded when nil
+	Logger logger.Logger
+	// MaxAttempts is the number of times a message is handled before it is
+	// dead-lettered, retries wait from InitialBackoff doubling up to MaxBackoff
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// DeadLetter is the Redis stream the messages that could not be handled
+	// are added to, whatever the transport, see DeadLetterChannel
+	DeadLetter string
+	// Workers handle messages concurrently, one when zero. Messages with the
+	// same PartitionKey are handled in order by the same worker, the ones
+	// without a key by any worker. Each worker queues up to QueueSize
+	// messages, DefaultQueueSize when zero, before reading is held back.
+	Workers      int
+	PartitionKey func(delivery Delivery) string
+	QueueSize    int
+	// ShutdownTimeout is how long Listen waits for the queued and running
+	// messages once cancelled, DefaultShutdownTimeout when zero
+	ShutdownTimeout time.Duration
 }
 
+// DefaultShutdownTimeout leaves room within the 10s docker waits before
+// killing a container
+const DefaultShutdownTimeout = 8 * time.Second
+
+// ErrShutdownTimeout is returned by Listen when the handlers were still
+// running after ShutdownTimeout, their messages are left unacknowledged
+var ErrShutdownTimeout = errors.New("message: handlers still running after the shutdown timeout")
+
 type Listener[TMessage any] interface {
-	Listen()
+	// Listen handles the messages of the channel until ctx is cancelled, then
+	// waits for the messages being handled before returning ctx.Err(), or
+	// ErrShutdownTimeout when they took longer than ShutdownTimeout
+	Listen(ctx context.Context) error
 }
 
 type listener[TMessage any] struct {
@@ -20,15 +59,152 @@ type listener[TMessage any] struct {
 	parser  MessageParser[TMessage]
 }
 
-func (l *listener[TMessage]) Listen() {
-	client := cache.NewClient(l.config.Redis.ConnString)
-	channel := cache.Subscribe(client, l.config.Channel)
+func (l *listener[TMessage]) Listen(ctx context.Context) error {
+	broker := l.config.Broker
+	if broker == nil {
+		var err error
+		broker, err = NewBroker(ctx, l.config.Redis)
+		if err != nil {
+			return err
+		}
+		defer broker.Close()
+	}
 
-	cache.Listen(channel, func(rawMessage string) {
+	deadLetters, ok := broker.(deadLetterWriter)
+	if !ok {
+		return fmt.Errorf("message: %T cannot keep dead letters", broker)
+	}
 
-		parsed := l.parser.ParseMessage(rawMessage)
-		l.handler.HandleMessage(parsed)
+	deliveries, err := broker.Subscribe(ctx, l.config.Channel)
+	if err != nil {
+		return err
+	}
+
+	// handlers outlive ctx so that a message being posted is not cut off
+	// halfway, they are only cancelled once ShutdownTimeout is over
+	handlerCtx, cancelHandlers := context.WithCancel(context.Background())
+	defer cancelHandlers()
+
+	pool := newWorkerPool(l.config.Workers, l.config.QueueSize, l.config.PartitionKey, func(delivery Delivery) {
+		l.process(handlerCtx, broker, deadLetters, delivery)
 	})
+
+	var undispatched *Delivery
+	closed := false
+	for !closed && ctx.Err() == nil {
+		select {
+		case <-ctx.Done():
+		case delivery, ok := <-deliveries:
+			closed = !ok
+			if ok && !pool.dispatch(ctx, delivery) {
+				undispatched = &delivery
+			}
+		}
+	}
+
+	l.log().Infof("[%s] Listener stopping, waiting up to %s for the messages being handled", l.config.Channel, l.config.shutdownTimeout())
+
+	// a delivery received while the queues were full is handled along with
+	// the queued ones, the broker may not deliver it again
+	deadline := time.Now().Add(l.config.shutdownTimeout())
+	shutdownCtx, cancelShutdown := context.WithDeadline(context.Background(), deadline)
+	defer cancelShutdown()
+	if undispatched != nil && !pool.dispatch(shutdownCtx, *undispatched) {
+		l.log().Warnf("[%s] Message %s left unhandled on shutdown, the queues stayed full", l.config.Channel, undispatched.ID)
+	}
+
+	if !pool.stop(time.Until(deadline)) {
+		cancelHandlers()
+		pool.wait()
+		return ErrShutdownTimeout
+	}
+
+	if ctx.Err() == nil {
+		return ErrBrokerClosed
+	}
+
+	return ctx.Err()
+}
+
+// process handles a delivery, dead-letters it once it failed for good and
+// acknowledges it. A delivery that cannot be dead-lettered, or whose handling
+// was cancelled on shutdown, is left unacknowledged for the broker to deliver
+// again.
+func (l *listener[TMessage]) process(ctx context.Context, broker Broker, deadLetters deadLetterWriter, delivery Delivery) {
+	if ctx.Err() != nil {
+		return
+	}
+
+	attempts, err := l.handle(ctx, delivery)
+	if err != nil && ctx.Err() != nil {
+		l.log().Warnf("[%s] Message %s cancelled on shutdown after %d attempts: %v", l.config.Channel, delivery.ID, attempts, err)
+		return
+	}
+
+	if err != nil {
+		deadLetter := DeadLetter{
+			ID:       delivery.ID,
+			Channel:  delivery.Channel,
+			Payload:  delivery.Payload,
+			Error:    err.Error(),
+			Attempts: attempts,
+			FailedAt: time.Now(),
+		}
+		l.log().Errorf(err, "[%s] Message %s failed after %d attempts, dead-lettering it to stream %s", l.config.Channel, delivery.ID, attempts, l.config.DeadLetterChannel())
+
+		payload, _ := json.Marshal(deadLetter)
+		if err := deadLetters.WriteDeadLetter(ctx, l.config.DeadLetterChannel(), payload); err != nil {
+			l.log().Errorf(err, "[%s] Failed to dead-letter message %s", l.config.Channel, delivery.ID)
+			return
+		}
+	}
+
+	if err := broker.Ack(ctx, delivery); err != nil {
+		l.log().Errorf(err, "[%s] Failed to acknowledge message %s", l.config.Channel, delivery.ID)
+	}
+}
+
+// handle parses and handles a delivery, retrying failures with backoff until
+// they are permanent, MaxAttempts is reached or ctx is cancelled
+func (l *listener[TMessage]) handle(ctx context.Context, delivery Delivery) (int, error) {
+	parsed, err := l.parser.ParseMessage(delivery.Payload)
+	if err != nil {
+		return 1, Permanent(err)
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := l.handler.HandleMessage(ctx, parsed)
+		if err == nil || IsPermanent(err) || attempt >= l.config.maxAttempts() {
+			return attempt, err
+		}
+
+		wait := l.config.backoff(attempt)
+		l.log().Warnf("[%s] Message %s failed: %v, retrying in %s (attempt %d)", l.config.Channel, delivery.ID, err, wait, attempt)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return attempt, err
+		case <-timer.C:
+		}
+	}
+}
+
+func (l *listener[TMessage]) log() logger.Logger {
+	if l.config.Logger == nil {
+		return logger.NopLogger{}
+	}
+
+	return l.config.Logger
+}
+
+func (c *ListenerConfig) shutdownTimeout() time.Duration {
+	if c.ShutdownTimeout <= 0 {
+		return DefaultShutdownTimeout
+	}
+
+	return c.ShutdownTimeout
 }
 
 func (c *ListenerConfig) validate() {
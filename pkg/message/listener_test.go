@@ -0,0 +1,256 @@
+package message
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/its-rav/makima/pkg/model"
+)
+
+// handlerFunc handles the text messages of the tests
+type handlerFunc func(ctx context.Context, text string) error
+
+func (f handlerFunc) HandleMessage(ctx context.Context, message model.PublishMessage[string]) error {
+	return f(ctx, message.Message)
+}
+
+type textParser struct{}
+
+func (textParser) ParseMessage(raw string) (model.PublishMessage[string], error) {
+	var message model.PublishMessage[string]
+	err := json.Unmarshal([]byte(raw), &message)
+
+	return message, err
+}
+
+func textPayload(text string) string {
+	payload, _ := json.Marshal(model.PublishMessage[string]{Message: text})
+	return string(payload)
+}
+
+// chanBroker hands the deliveries sent on its channel to the listener and
+// records the acknowledged ones
+type chanBroker struct {
+	deliveries chan Delivery
+
+	mu    sync.Mutex
+	acked []string
+}
+
+func (b *chanBroker) Publish(ctx context.Context, channel string, payload []byte) error {
+	return nil
+}
+
+func (b *chanBroker) Subscribe(ctx context.Context, channel string) (<-chan Delivery, error) {
+	return b.deliveries, nil
+}
+
+func (b *chanBroker) Ack(ctx context.Context, delivery Delivery) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.acked = append(b.acked, delivery.ID)
+	return nil
+}
+
+func (b *chanBroker) WriteDeadLetter(ctx context.Context, stream string, payload []byte) error {
+	return nil
+}
+
+func (b *chanBroker) Close() error {
+	return nil
+}
+
+func TestListenerHandlesReceivedDeliveriesOnShutdown(t *testing.T) {
+	broker := &chanBroker{deliveries: make(chan Delivery)}
+	started := make(chan struct{}, 3)
+	release := make(chan struct{})
+
+	var mu sync.Mutex
+	var handled []string
+	l := NewListener[string](ListenerConfig{
+		Channel:         "tweets",
+		Broker:          broker,
+		Workers:         1,
+		QueueSize:       1,
+		ShutdownTimeout: time.Second,
+	}, handlerFunc(func(ctx context.Context, text string) error {
+		started <- struct{}{}
+		<-release
+
+		mu.Lock()
+		handled = append(handled, text)
+		mu.Unlock()
+		return nil
+	}), textParser{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- l.Listen(ctx) }()
+
+	// the first message runs, the second fills the queue and the third is
+	// received while the queue is full
+	broker.deliveries <- Delivery{ID: "1", Channel: "tweets", Payload: textPayload("1")}
+	<-started
+	broker.deliveries <- Delivery{ID: "2", Channel: "tweets", Payload: textPayload("2")}
+	broker.deliveries <- Delivery{ID: "3", Channel: "tweets", Payload: textPayload("3")}
+
+	cancel()
+	close(release)
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("Listen returned %v, want context.Canceled", err)
+	}
+
+	if want := []string{"1", "2", "3"}; !reflect.DeepEqual(handled, want) {
+		t.Errorf("handled %v, want %v", handled, want)
+	}
+	if want := []string{"1", "2", "3"}; !reflect.DeepEqual(broker.acked, want) {
+		t.Errorf("acknowledged %v, want %v", broker.acked, want)
+	}
+}
+
+// listen runs a listener on broker until the test ends, once it subscribed
+func listen(t *testing.T, broker *MemoryBroker, config ListenerConfig, handler MessageHandler[string]) {
+	t.Helper()
+
+	config.Broker = broker
+	l := NewListener[string](config, handler, textParser{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- l.Listen(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		broker.mu.RLock()
+		subscribed := len(broker.subs[config.Channel]) > 0
+		broker.mu.RUnlock()
+		if subscribed {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("listener did not subscribe")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// failing returns a handler failing with err until it was called failures
+// times, counting its calls
+func failing(failures int32, err error) (handlerFunc, *atomic.Int32) {
+	calls := &atomic.Int32{}
+
+	return func(ctx context.Context, text string) error {
+		if calls.Add(1) <= failures {
+			return err
+		}
+		return nil
+	}, calls
+}
+
+func TestListenerRetriesFailures(t *testing.T) {
+	broker := NewMemoryBroker()
+	defer broker.Close()
+
+	deadLetters, _ := broker.Subscribe(context.Background(), "tweets"+DeadLetterSuffix)
+	handled := make(chan struct{})
+	handler, calls := failing(2, errors.New("webhook unavailable"))
+	listen(t, broker, ListenerConfig{
+		Channel:        "tweets",
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+	}, handlerFunc(func(ctx context.Context, text string) error {
+		err := handler(ctx, text)
+		if err == nil {
+			close(handled)
+		}
+		return err
+	}))
+
+	broker.Publish(context.Background(), "tweets", []byte(textPayload("tweet")))
+
+	select {
+	case <-handled:
+	case <-time.After(time.Second):
+		t.Fatalf("message not handled after %d attempts", calls.Load())
+	}
+	if calls.Load() != 3 {
+		t.Errorf("handled after %d attempts, want 3", calls.Load())
+	}
+
+	select {
+	case deadLetter := <-deadLetters:
+		t.Errorf("handled message dead-lettered: %s", deadLetter.Payload)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestListenerDeadLetters(t *testing.T) {
+	tests := []struct {
+		name     string
+		payload  string
+		err      error
+		attempts int
+	}{
+		{name: "attempts exhausted", payload: textPayload("tweet"), err: errors.New("webhook unavailable"), attempts: 3},
+		{name: "permanent", payload: textPayload("tweet"), err: Permanent(errors.New("embed rejected")), attempts: 1},
+		{name: "unparsable", payload: "{not json", attempts: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			broker := NewMemoryBroker()
+			defer broker.Close()
+
+			deadLetters, _ := broker.Subscribe(context.Background(), "tweets"+DeadLetterSuffix)
+			handler, calls := failing(100, tt.err)
+			listen(t, broker, ListenerConfig{
+				Channel:        "tweets",
+				MaxAttempts:    3,
+				InitialBackoff: time.Millisecond,
+				MaxBackoff:     time.Millisecond,
+			}, handler)
+
+			broker.Publish(context.Background(), "tweets", []byte(tt.payload))
+
+			deadLetter, err := ParseDeadLetter(receive(t, deadLetters).Payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if deadLetter.Channel != "tweets" || deadLetter.Payload != tt.payload || deadLetter.Attempts != tt.attempts || deadLetter.Error == "" {
+				t.Errorf("dead letter %+v, want the payload of tweets after %d attempts with the error", deadLetter, tt.attempts)
+			}
+			if tt.err != nil && int(calls.Load()) != tt.attempts {
+				t.Errorf("handler called %d times, want %d", calls.Load(), tt.attempts)
+			}
+		})
+	}
+}
+
+func TestListenerBackoff(t *testing.T) {
+	config := ListenerConfig{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
+
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, wait := range want {
+		if got := config.backoff(i + 1); got != wait {
+			t.Errorf("retry after attempt %d waits %s, want %s", i+1, got, wait)
+		}
+	}
+
+	if got := (&ListenerConfig{}).backoff(1); got != DefaultInitialBackoff {
+		t.Errorf("default first retry waits %s, want %s", got, DefaultInitialBackoff)
+	}
+}
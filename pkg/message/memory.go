@@ -0,0 +1,167 @@
+package message
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultMemoryBuffer is the number of messages a memory subscription holds
+// before Publish blocks
+const DefaultMemoryBuffer = 100
+
+// ErrBrokerClosed is returned by the operations of a closed broker
+var ErrBrokerClosed = errors.New("message: broker closed")
+
+// memorySubscription queues the messages published to its channel and hands
+// them over to the subscriber. Only its own goroutine closes deliveries, once
+// done is closed, so that Publish never sends on a closed channel.
+type memorySubscription struct {
+	queue      chan Delivery
+	deliveries chan Delivery
+	done       chan struct{}
+	stopOnce   sync.Once
+}
+
+func (s *memorySubscription) stop() {
+	s.stopOnce.Do(func() { close(s.done) })
+}
+
+func (s *memorySubscription) run(ctx context.Context) {
+	defer close(s.deliveries)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.done:
+			return
+		case delivery := <-s.queue:
+			select {
+			case s.deliveries <- delivery:
+			case <-ctx.Done():
+				return
+			case <-s.done:
+				return
+			}
+		}
+	}
+}
+
+// MemoryBroker delivers messages within the process to every subscriber of
+// their channel, nothing is kept for channels without subscribers. It is meant
+// for tests and for embedding publishers and listeners in the same process,
+// the binaries only use the Redis brokers.
+type MemoryBroker struct {
+	nextID atomic.Int64
+
+	mu     sync.RWMutex
+	subs   map[string][]*memorySubscription
+	closed bool
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		subs: make(map[string][]*memorySubscription),
+	}
+}
+
+// Publish waits while a subscriber has DefaultMemoryBuffer messages queued,
+// the lock is not held meanwhile so that the subscriber can publish in turn
+func (b *MemoryBroker) Publish(ctx context.Context, channel string, payload []byte) error {
+	b.mu.RLock()
+	if b.closed {
+		b.mu.RUnlock()
+		return ErrBrokerClosed
+	}
+	subs := append([]*memorySubscription(nil), b.subs[channel]...)
+	b.mu.RUnlock()
+
+	delivery := Delivery{
+		ID:      strconv.FormatInt(b.nextID.Add(1), 10),
+		Channel: channel,
+		Payload: string(payload),
+	}
+
+	for _, sub := range subs {
+		select {
+		case sub.queue <- delivery:
+		case <-sub.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return nil
+}
+
+func (b *MemoryBroker) Subscribe(ctx context.Context, channel string) (<-chan Delivery, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, ErrBrokerClosed
+	}
+
+	sub := &memorySubscription{
+		queue:      make(chan Delivery, DefaultMemoryBuffer),
+		deliveries: make(chan Delivery),
+		done:       make(chan struct{}),
+	}
+	b.subs[channel] = append(b.subs[channel], sub)
+
+	go func() {
+		sub.run(ctx)
+		b.unsubscribe(channel, sub)
+	}()
+
+	return sub.deliveries, nil
+}
+
+// unsubscribe removes sub from channel once its subscriber is gone
+func (b *MemoryBroker) unsubscribe(channel string, sub *memorySubscription) {
+	sub.stop()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	subs := b.subs[channel]
+	for i := range subs {
+		if subs[i] == sub {
+			b.subs[channel] = append(subs[:i:i], subs[i+1:]...)
+			return
+		}
+	}
+}
+
+// WriteDeadLetter publishes the dead letter to the subscribers of stream
+// within the process
+func (b *MemoryBroker) WriteDeadLetter(ctx context.Context, stream string, payload []byte) error {
+	return b.Publish(ctx, stream, payload)
+}
+
+// Ack is a no-op, messages are handed over once delivered
+func (b *MemoryBroker) Ack(ctx context.Context, delivery Delivery) error {
+	return nil
+}
+
+func (b *MemoryBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+
+	for _, subs := range b.subs {
+		for _, sub := range subs {
+			sub.stop()
+		}
+	}
+	b.subs = nil
+
+	return nil
+}
@@ -0,0 +1,143 @@
+package message
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// receive returns the next delivery of deliveries, failing after a second
+func receive(t *testing.T, deliveries <-chan Delivery) Delivery {
+	t.Helper()
+
+	select {
+	case delivery, ok := <-deliveries:
+		if !ok {
+			t.Fatal("deliveries closed")
+		}
+		return delivery
+	case <-time.After(time.Second):
+		t.Fatal("no delivery received")
+	}
+
+	return Delivery{}
+}
+
+// waitClosed fails unless deliveries is closed within a second, pending
+// deliveries are discarded
+func waitClosed(t *testing.T, deliveries <-chan Delivery) {
+	t.Helper()
+
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-deliveries:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("deliveries not closed")
+		}
+	}
+}
+
+func TestMemoryBrokerDeliversToEverySubscriber(t *testing.T) {
+	broker := NewMemoryBroker()
+	defer broker.Close()
+
+	ctx := context.Background()
+	first, _ := broker.Subscribe(ctx, "tweets")
+	second, _ := broker.Subscribe(ctx, "tweets")
+	other, _ := broker.Subscribe(ctx, "other")
+
+	for _, payload := range []string{"a", "b"} {
+		if err := broker.Publish(ctx, "tweets", []byte(payload)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, deliveries := range []<-chan Delivery{first, second} {
+		for _, want := range []string{"a", "b"} {
+			if got := receive(t, deliveries); got.Payload != want || got.Channel != "tweets" {
+				t.Errorf("received %+v, want payload %q on tweets", got, want)
+			}
+		}
+	}
+
+	select {
+	case delivery := <-other:
+		t.Errorf("other channel received %+v", delivery)
+	default:
+	}
+}
+
+func TestMemoryBrokerUnsubscribesOnCancel(t *testing.T) {
+	broker := NewMemoryBroker()
+	defer broker.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	deliveries, _ := broker.Subscribe(ctx, "tweets")
+	cancel()
+	waitClosed(t, deliveries)
+
+	// nobody is subscribed any more, publishing must not wait for the buffer
+	for i := 0; i <= DefaultMemoryBuffer; i++ {
+		if err := broker.Publish(context.Background(), "tweets", []byte("a")); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMemoryBrokerClose(t *testing.T) {
+	broker := NewMemoryBroker()
+
+	deliveries, _ := broker.Subscribe(context.Background(), "tweets")
+	broker.Close()
+	waitClosed(t, deliveries)
+
+	if err := broker.Publish(context.Background(), "tweets", []byte("a")); !errors.Is(err, ErrBrokerClosed) {
+		t.Errorf("Publish after Close returned %v, want ErrBrokerClosed", err)
+	}
+	if _, err := broker.Subscribe(context.Background(), "tweets"); !errors.Is(err, ErrBrokerClosed) {
+		t.Errorf("Subscribe after Close returned %v, want ErrBrokerClosed", err)
+	}
+}
+
+// A subscriber dead-lettering a message while a publisher waits on its full
+// buffer must not block
+func TestMemoryBrokerDeadLetterWhileBackedUp(t *testing.T) {
+	broker := NewMemoryBroker()
+	defer broker.Close()
+
+	ctx := context.Background()
+	deliveries, _ := broker.Subscribe(ctx, "tweets")
+
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		for i := 0; i < DefaultMemoryBuffer+2; i++ {
+			broker.Publish(ctx, "tweets", []byte("a"))
+		}
+	}()
+
+	receive(t, deliveries)
+	time.Sleep(10 * time.Millisecond)
+
+	written := make(chan error, 1)
+	go func() { written <- broker.WriteDeadLetter(ctx, "tweets:dlq", []byte("dead")) }()
+
+	select {
+	case err := <-written:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("WriteDeadLetter blocked behind the publisher")
+	}
+
+	for i := 1; i < DefaultMemoryBuffer+2; i++ {
+		receive(t, deliveries)
+	}
+	<-published
+}
@@ -0,0 +1,108 @@
+package message
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// DefaultQueueSize is the number of messages waiting for each worker before
+// the listener stops reading from the broker
+const DefaultQueueSize = 16
+
+// workerPool runs messages on a fixed number of workers. Messages sharing a
+// partition key always go to the same worker, in order, messages without a
+// key are spread over the workers.
+type workerPool struct {
+	queues []chan Delivery
+	key    func(delivery Delivery) string
+	next   int
+	wg     sync.WaitGroup
+}
+
+func newWorkerPool(workers int, queueSize int, key func(delivery Delivery) string, process func(delivery Delivery)) *workerPool {
+	if workers <= 0 {
+		workers = 1
+	}
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
+
+	p := &workerPool{
+		queues: make([]chan Delivery, workers),
+		key:    key,
+	}
+
+	for i := range p.queues {
+		queue := make(chan Delivery, queueSize)
+		p.queues[i] = queue
+
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for delivery := range queue {
+				process(delivery)
+			}
+		}()
+	}
+
+	return p
+}
+
+// dispatch queues delivery on its worker, blocking while the queue is full.
+// It reports false when ctx is cancelled first, delivery is not queued then.
+func (p *workerPool) dispatch(ctx context.Context, delivery Delivery) bool {
+	select {
+	case p.queues[p.worker(delivery)] <- delivery:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (p *workerPool) worker(delivery Delivery) int {
+	var key string
+	if p.key != nil {
+		key = p.key(delivery)
+	}
+
+	if key == "" {
+		p.next = (p.next + 1) % len(p.queues)
+		return p.next
+	}
+
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+
+	return int(hash.Sum32() % uint32(len(p.queues)))
+}
+
+// stop waits up to timeout for the queued messages to be processed, it
+// reports false when some are still running
+func (p *workerPool) stop(timeout time.Duration) bool {
+	for _, queue := range p.queues {
+		close(queue)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// wait blocks until the workers are done, after stop
+func (p *workerPool) wait() {
+	p.wg.Wait()
+}
@@ -0,0 +1,127 @@
+package message
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func partitionByChannel(delivery Delivery) string {
+	return delivery.Channel
+}
+
+func TestWorkerPoolKeepsKeyOrder(t *testing.T) {
+	var mu sync.Mutex
+	handled := make(map[string][]string)
+
+	pool := newWorkerPool(4, 2, partitionByChannel, func(delivery Delivery) {
+		// later messages of a key finish first unless they wait their turn
+		if delivery.ID == "0" {
+			time.Sleep(20 * time.Millisecond)
+		}
+
+		mu.Lock()
+		handled[delivery.Channel] = append(handled[delivery.Channel], delivery.ID)
+		mu.Unlock()
+	})
+
+	keys := []string{"a", "b", "c", "d", "e"}
+	for i := 0; i < 10; i++ {
+		for _, key := range keys {
+			pool.dispatch(context.Background(), Delivery{ID: fmt.Sprint(i), Channel: key})
+		}
+	}
+	if !pool.stop(5 * time.Second) {
+		t.Fatal("pool did not drain")
+	}
+
+	for _, key := range keys {
+		ids := handled[key]
+		if len(ids) != 10 {
+			t.Fatalf("key %s handled %d messages, want 10", key, len(ids))
+		}
+		for i, id := range ids {
+			if id != fmt.Sprint(i) {
+				t.Errorf("key %s handled in order %v", key, ids)
+				break
+			}
+		}
+	}
+}
+
+func TestWorkerPoolRunsKeysConcurrently(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan string, 2)
+
+	pool := newWorkerPool(2, 1, partitionByChannel, func(delivery Delivery) {
+		started <- delivery.Channel
+		<-release
+	})
+	defer pool.stop(time.Second)
+	defer close(release)
+
+	// keys hashed to different workers
+	var keys []string
+	workers := make(map[int]bool)
+	for i := 0; len(keys) < 2; i++ {
+		key := fmt.Sprint("key", i)
+		if worker := pool.worker(Delivery{Channel: key}); !workers[worker] {
+			workers[worker] = true
+			keys = append(keys, key)
+		}
+	}
+
+	for _, key := range keys {
+		pool.dispatch(context.Background(), Delivery{Channel: key})
+	}
+
+	for range keys {
+		select {
+		case <-started:
+		case <-time.After(time.Second):
+			t.Fatal("a slow key held back the other one")
+		}
+	}
+}
+
+func TestWorkerPoolBackpressure(t *testing.T) {
+	release := make(chan struct{})
+	pool := newWorkerPool(1, 2, nil, func(delivery Delivery) {
+		<-release
+	})
+
+	// one message running and two queued fill the pool
+	for i := 0; i < 3; i++ {
+		if !pool.dispatch(context.Background(), Delivery{}) {
+			t.Fatalf("message %d not queued", i)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if pool.dispatch(ctx, Delivery{}) {
+		t.Error("message queued on a full pool")
+	}
+
+	close(release)
+	if !pool.stop(time.Second) {
+		t.Error("pool did not drain")
+	}
+}
+
+func TestWorkerPoolStopTimeout(t *testing.T) {
+	release := make(chan struct{})
+	pool := newWorkerPool(1, 1, nil, func(delivery Delivery) {
+		<-release
+	})
+	pool.dispatch(context.Background(), Delivery{})
+
+	if pool.stop(20 * time.Millisecond) {
+		t.Error("stop reported a drained pool while a message was running")
+	}
+
+	close(release)
+	pool.wait()
+}
@@ -0,0 +1,353 @@
+package message
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/its-rav/makima/pkg/cache"
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisPubSubBroker uses Redis Pub/Sub, messages published while no consumer
+// is subscribed are lost
+type RedisPubSubBroker struct {
+	client *redis.Client
+
+	mu   sync.Mutex
+	subs []*redis.PubSub
+}
+
+func NewRedisPubSubBroker(client *redis.Client) *RedisPubSubBroker {
+	return &RedisPubSubBroker{
+		client: client,
+	}
+}
+
+func (b *RedisPubSubBroker) Publish(ctx context.Context, channel string, payload []byte) error {
+	return b.client.Publish(ctx, channel, string(payload)).Err()
+}
+
+func (b *RedisPubSubBroker) Subscribe(ctx context.Context, channel string) (<-chan Delivery, error) {
+	pubsub := b.client.Subscribe(ctx, channel)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, err
+	}
+
+	b.mu.Lock()
+	b.subs = append(b.subs, pubsub)
+	b.mu.Unlock()
+
+	deliveries := make(chan Delivery)
+	go func() {
+		defer close(deliveries)
+		defer b.unsubscribe(pubsub)
+
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+
+				select {
+				case deliveries <- Delivery{Channel: msg.Channel, Payload: msg.Payload}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return deliveries, nil
+}
+
+// unsubscribe closes the connection of pubsub, which drops its subscriptions
+func (b *RedisPubSubBroker) unsubscribe(pubsub *redis.PubSub) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i := range b.subs {
+		if b.subs[i] == pubsub {
+			b.subs = append(b.subs[:i:i], b.subs[i+1:]...)
+			pubsub.Close()
+			return
+		}
+	}
+}
+
+// WriteDeadLetter adds the dead letter to a stream rather than publishing it,
+// nobody listens to the dead-letter channel
+func (b *RedisPubSubBroker) WriteDeadLetter(ctx context.Context, stream string, payload []byte) error {
+	return cache.AddStream(ctx, b.client, stream, 0, payload)
+}
+
+// Ack is a no-op, Pub/Sub has no acknowledgements
+func (b *RedisPubSubBroker) Ack(ctx context.Context, delivery Delivery) error {
+	return nil
+}
+
+func (b *RedisPubSubBroker) Close() error {
+	b.mu.Lock()
+	for _, pubsub := range b.subs {
+		pubsub.Close()
+	}
+	b.subs = nil
+	b.mu.Unlock()
+
+	return b.client.Close()
+}
+
+const (
+	DefaultStreamGroup        = "makima"
+	DefaultStreamMaxLen       = 10000
+	DefaultStreamClaimMinIdle = time.Minute
+)
+
+// RedisStreamsOptions configures the consumer group of a RedisStreamsBroker,
+// zero values are replaced with the defaults
+type RedisStreamsOptions struct {
+	// Group is DefaultStreamGroup when empty, Consumer the hostname
+	Group    string
+	Consumer string
+	// MaxLen is the approximate number of entries kept per stream,
+	// DefaultStreamMaxLen when zero
+	MaxLen int64
+	// ClaimMinIdle is how long an entry stays pending on a crashed consumer
+	// before this one takes it over, DefaultStreamClaimMinIdle when zero
+	ClaimMinIdle time.Duration
+}
+
+func (o RedisStreamsOptions) withDefaults() RedisStreamsOptions {
+	if o.Group == "" {
+		o.Group = DefaultStreamGroup
+	}
+	if o.Consumer == "" {
+		o.Consumer, _ = os.Hostname()
+	}
+	if o.MaxLen <= 0 {
+		o.MaxLen = DefaultStreamMaxLen
+	}
+	if o.ClaimMinIdle <= 0 {
+		o.ClaimMinIdle = DefaultStreamClaimMinIdle
+	}
+
+	return o
+}
+
+// RedisStreamsBroker stores messages in a stream per channel and reads them
+// as a member of a consumer group, messages stay pending until acknowledged
+type RedisStreamsBroker struct {
+	client *redis.Client
+	opts   RedisStreamsOptions
+
+	// inFlight holds the ids of the entries delivered and not acknowledged
+	// yet, by channel
+	mu       sync.Mutex
+	inFlight map[string]map[string]bool
+
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+func NewRedisStreamsBroker(client *redis.Client, opts RedisStreamsOptions) *RedisStreamsBroker {
+	return &RedisStreamsBroker{
+		client:   client,
+		opts:     opts.withDefaults(),
+		inFlight: make(map[string]map[string]bool),
+		done:     make(chan struct{}),
+	}
+}
+
+// track marks an entry as delivered, it returns false when it already is
+func (b *RedisStreamsBroker) track(channel string, id string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ids := b.inFlight[channel]
+	if ids == nil {
+		ids = make(map[string]bool)
+		b.inFlight[channel] = ids
+	}
+	if ids[id] {
+		return false
+	}
+	ids[id] = true
+
+	return true
+}
+
+func (b *RedisStreamsBroker) untrack(channel string, id string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.inFlight[channel], id)
+}
+
+func (b *RedisStreamsBroker) tracked(channel string) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var ids []string
+	for id := range b.inFlight[channel] {
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+func (b *RedisStreamsBroker) group(channel string) cache.StreamGroup {
+	return cache.StreamGroup{
+		Stream:       channel,
+		Group:        b.opts.Group,
+		Consumer:     b.opts.Consumer,
+		ClaimMinIdle: b.opts.ClaimMinIdle,
+	}
+}
+
+func (b *RedisStreamsBroker) Publish(ctx context.Context, channel string, payload []byte) error {
+	return cache.AddStream(ctx, b.client, channel, b.opts.MaxLen, payload)
+}
+
+// Subscribe first delivers the entries left pending by a previous run of the
+// consumer, then new entries, claiming the ones abandoned by crashed
+// consumers every ClaimMinIdle. The entries delivered and not acknowledged
+// yet, whether queued in the listener or being handled, are touched every
+// ClaimMinIdle/2 so that they never look abandoned to the other consumers.
+func (b *RedisStreamsBroker) Subscribe(ctx context.Context, channel string) (<-chan Delivery, error) {
+	group := b.group(channel)
+	if err := cache.CreateStreamGroup(ctx, b.client, group); err != nil {
+		return nil, err
+	}
+
+	pending, err := cache.ReadStream(ctx, b.client, group, "0", 0, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	// reading stops when either the subscriber or the broker is done
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-b.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	// touching does not wait for the reader, which blocks while the listener
+	// queues are full
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+
+		ticker := time.NewTicker(group.ClaimMinIdle / 2)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if ids := b.tracked(channel); len(ids) > 0 {
+					cache.TouchStream(ctx, b.client, group, ids...)
+				}
+			}
+		}
+	}()
+
+	deliveries := make(chan Delivery)
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		defer cancel()
+		defer close(deliveries)
+
+		deliver := func(messages []cache.StreamMessage) bool {
+			for _, message := range messages {
+				// entries trimmed by MAXLEN while pending are claimed without payload
+				if message.Payload == "" {
+					cache.AckStream(ctx, b.client, group, message.ID)
+					continue
+				}
+
+				if !b.track(channel, message.ID) {
+					continue
+				}
+
+				select {
+				case deliveries <- Delivery{ID: message.ID, Channel: channel, Payload: message.Payload}:
+				case <-ctx.Done():
+					b.untrack(channel, message.ID)
+					return false
+				}
+			}
+
+			return true
+		}
+
+		if !deliver(pending) {
+			return
+		}
+
+		var lastClaim time.Time
+		for {
+			if ctx.Err() != nil {
+				return
+			}
+
+			if time.Since(lastClaim) >= group.ClaimMinIdle {
+				lastClaim = time.Now()
+				for start := "0-0"; ; {
+					claimed, next, err := cache.ClaimStream(ctx, b.client, group, start, cache.DefaultStreamCount)
+					if err != nil || !deliver(claimed) || next == "" {
+						break
+					}
+					start = next
+				}
+			}
+
+			messages, err := cache.ReadStream(ctx, b.client, group, ">", cache.DefaultStreamCount, cache.DefaultStreamBlock)
+			if err != nil {
+				// the connection is closed along with the broker
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(time.Second):
+					continue
+				}
+			}
+			if !deliver(messages) {
+				return
+			}
+		}
+	}()
+
+	return deliveries, nil
+}
+
+// WriteDeadLetter adds the dead letter to stream, dead letters are never
+// trimmed
+func (b *RedisStreamsBroker) WriteDeadLetter(ctx context.Context, stream string, payload []byte) error {
+	return cache.AddStream(ctx, b.client, stream, 0, payload)
+}
+
+func (b *RedisStreamsBroker) Ack(ctx context.Context, delivery Delivery) error {
+	b.untrack(delivery.Channel, delivery.ID)
+
+	return cache.AckStream(ctx, b.client, b.group(delivery.Channel), delivery.ID)
+}
+
+func (b *RedisStreamsBroker) Close() error {
+	b.closeOnce.Do(func() { close(b.done) })
+	err := b.client.Close()
+	b.wg.Wait()
+
+	return err
+}
@@ -0,0 +1,92 @@
+package twitter
+
+import "time"
+
+// reconnect schedules documented for the v2 filtered stream:
+// - network errors back off linearly by 250ms up to 16s
+// - HTTP errors back off exponentially from 5s up to 320s
+// - HTTP 429 backs off exponentially from 1 minute
+// they are variables for the tests to shorten them
+var (
+	networkBackoffStep   = 250 * time.Millisecond
+	networkBackoffMax    = 16 * time.Second
+	httpBackoffMin       = 5 * time.Second
+	httpBackoffMax       = 320 * time.Second
+	rateLimitBackoffMin  = 1 * time.Minute
+	rateLimitBackoffMax  = 16 * time.Minute
+	rateLimitResetMargin = 1 * time.Second
+)
+
+type backoffKind int
+
+const (
+	backoffNone backoffKind = iota
+	backoffNetwork
+	backoffHTTP
+	backoffRateLimit
+)
+
+// backoff keeps track of consecutive reconnect attempts of the same kind,
+// switching schedules restarts the count
+type backoff struct {
+	kind    backoffKind
+	attempt int
+}
+
+// reset is called once a connection has been established successfully
+func (b *backoff) reset() {
+	b.kind = backoffNone
+	b.attempt = 0
+}
+
+func (b *backoff) next(kind backoffKind) int {
+	if b.kind != kind {
+		b.kind = kind
+		b.attempt = 0
+	}
+	b.attempt++
+
+	return b.attempt
+}
+
+// network returns the wait before reconnecting after a TCP/IP level error
+func (b *backoff) network() time.Duration {
+	wait := time.Duration(b.next(backoffNetwork)) * networkBackoffStep
+	if wait > networkBackoffMax {
+		wait = networkBackoffMax
+	}
+
+	return wait
+}
+
+// http returns the wait before reconnecting after an HTTP error status
+func (b *backoff) http() time.Duration {
+	return exponential(httpBackoffMin, httpBackoffMax, b.next(backoffHTTP))
+}
+
+// rateLimit returns the wait before reconnecting after an HTTP 429,
+// never returning before the rate limit window resets
+func (b *backoff) rateLimit(reset time.Time) time.Duration {
+	wait := exponential(rateLimitBackoffMin, rateLimitBackoffMax, b.next(backoffRateLimit))
+
+	if !reset.IsZero() {
+		untilReset := time.Until(reset) + rateLimitResetMargin
+		if untilReset > wait {
+			wait = untilReset
+		}
+	}
+
+	return wait
+}
+
+func exponential(min time.Duration, max time.Duration, attempt int) time.Duration {
+	wait := min
+	for i := 1; i < attempt && wait < max; i++ {
+		wait *= 2
+	}
+	if wait > max {
+		wait = max
+	}
+
+	return wait
+}
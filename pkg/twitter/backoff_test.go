@@ -0,0 +1,85 @@
+package twitter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffSchedules(t *testing.T) {
+	tests := []struct {
+		name string
+		next func(b *backoff) time.Duration
+		want []time.Duration
+	}{
+		{
+			name: "network",
+			next: (*backoff).network,
+			want: []time.Duration{250 * time.Millisecond, 500 * time.Millisecond, 750 * time.Millisecond},
+		},
+		{
+			name: "http",
+			next: (*backoff).http,
+			want: []time.Duration{5 * time.Second, 10 * time.Second, 20 * time.Second, 40 * time.Second, 80 * time.Second, 160 * time.Second, 320 * time.Second, 320 * time.Second},
+		},
+		{
+			name: "rate limit",
+			next: func(b *backoff) time.Duration { return b.rateLimit(time.Time{}) },
+			want: []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute, 16 * time.Minute, 16 * time.Minute},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b backoff
+			for i, want := range tt.want {
+				if got := tt.next(&b); got != want {
+					t.Errorf("attempt %d waits %s, want %s", i+1, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestBackoffNetworkCap(t *testing.T) {
+	var b backoff
+	var wait time.Duration
+	for i := 0; i < 100; i++ {
+		wait = b.network()
+	}
+
+	if wait != 16*time.Second {
+		t.Errorf("attempt 100 waits %s, want the 16s cap", wait)
+	}
+}
+
+func TestBackoffRestartsOnKindChange(t *testing.T) {
+	var b backoff
+	b.http()
+	b.http()
+
+	if wait := b.network(); wait != 250*time.Millisecond {
+		t.Errorf("first network error after HTTP errors waits %s, want 250ms", wait)
+	}
+	if wait := b.http(); wait != 5*time.Second {
+		t.Errorf("first HTTP error after a network error waits %s, want 5s", wait)
+	}
+
+	b.reset()
+	if wait := b.http(); wait != 5*time.Second {
+		t.Errorf("first HTTP error after a reset waits %s, want 5s", wait)
+	}
+}
+
+func TestBackoffRateLimitWaitsForReset(t *testing.T) {
+	var b backoff
+
+	reset := time.Now().Add(10 * time.Minute)
+	if wait := b.rateLimit(reset); wait < 10*time.Minute || wait > 10*time.Minute+rateLimitResetMargin {
+		t.Errorf("waits %s for a reset in 10 minutes, want 10 minutes and the margin", wait)
+	}
+
+	// the schedule is longer than the wait for a reset that passed
+	if wait := b.rateLimit(time.Now().Add(-time.Minute)); wait != 2*time.Minute {
+		t.Errorf("second attempt waits %s past the reset, want 2m", wait)
+	}
+}
@@ -0,0 +1,274 @@
+package twitter
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CaptureRecord is one chunk of raw stream bytes as read from the connection,
+// keep-alives and error objects included. A record with Connected set marks
+// the start of a new connection and carries no data.
+type CaptureRecord struct {
+	At        time.Time `json:"at"`
+	Connected bool      `json:"connected,omitempty"`
+	Data      []byte    `json:"data,omitempty"`
+}
+
+// CaptureWriter appends every write as a CaptureRecord line to a file,
+// rotating it to path.1, path.2, ... once it grows over MaxBytes
+type CaptureWriter struct {
+	path     string
+	maxBytes int64
+	maxFiles int
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+// NewCaptureWriter opens path for appending, maxBytes <= 0 disables rotation
+// and maxFiles is the number of rotated files kept
+func NewCaptureWriter(path string, maxBytes int64, maxFiles int) (*CaptureWriter, error) {
+	w := &CaptureWriter{
+		path:     path,
+		maxBytes: maxBytes,
+		maxFiles: maxFiles,
+	}
+
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func (w *CaptureWriter) open() error {
+	file, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	w.file = file
+	w.size = info.Size()
+
+	return nil
+}
+
+// rotate must be called with w.mu held
+func (w *CaptureWriter) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+
+	for i := w.maxFiles - 1; i > 0; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", w.path, i), fmt.Sprintf("%s.%d", w.path, i+1))
+	}
+
+	if w.maxFiles > 0 {
+		if err := os.Rename(w.path, w.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(w.path); err != nil {
+		return err
+	}
+
+	return w.open()
+}
+
+func (w *CaptureWriter) Write(p []byte) (int, error) {
+	if err := w.append(CaptureRecord{At: time.Now(), Data: p}); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// MarkConnection records the start of a connection, Replay decodes the bytes
+// of each connection separately so that a payload cut off by a disconnect
+// does not spoil the next ones
+func (w *CaptureWriter) MarkConnection() error {
+	return w.append(CaptureRecord{At: time.Now(), Connected: true})
+}
+
+func (w *CaptureWriter) append(record CaptureRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.maxBytes > 0 && w.size > 0 && w.size+int64(len(line)) > w.maxBytes {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := w.file.Write(line)
+	w.size += int64(n)
+
+	return err
+}
+
+func (w *CaptureWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.file.Close()
+}
+
+// CaptureFiles returns the files of the captures at paths oldest first, the
+// files rotated from each path followed by the path itself
+func CaptureFiles(paths []string) []string {
+	var files []string
+	seen := make(map[string]bool)
+	add := func(file string) {
+		if !seen[file] {
+			seen[file] = true
+			files = append(files, file)
+		}
+	}
+
+	for _, path := range paths {
+		matches, _ := filepath.Glob(path + ".*")
+
+		var rotated []int
+		for _, match := range matches {
+			if n, err := strconv.Atoi(strings.TrimPrefix(match, path+".")); err == nil && n > 0 {
+				rotated = append(rotated, n)
+			}
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(rotated)))
+
+		for _, n := range rotated {
+			add(fmt.Sprintf("%s.%d", path, n))
+		}
+		add(path)
+	}
+
+	return files
+}
+
+// Replay feeds captured stream bytes from the captures at paths, see
+// CaptureFiles, through the same decoding path as Stream. speed scales the
+// original pacing, 2 replays twice as fast and 0 or less replays without
+// waiting.
+//
+// The bytes of each connection are decoded separately, like Stream does. A
+// connection that ends with a malformed or cut off payload is logged and the
+// replay goes on with the next one. Only the Logger and OnError options are
+// used, error objects never stop the replay. Replay returns nil once every
+// file has been replayed.
+func Replay(ctx context.Context, paths []string, speed float64, opts StreamOptions, callback func(tweet TweetResponse)) error {
+	connections := make(chan *io.PipeReader)
+	done := make(chan error, 1)
+	go func() {
+		defer close(connections)
+		done <- replayCapture(ctx, CaptureFiles(paths), speed, connections)
+	}()
+
+	for connection := range connections {
+		err := decodeStream(connection, func(streamErr *StreamError) bool {
+			opts.onError(streamErr)
+			return false
+		}, callback)
+		if err != ErrStreamClosed && ctx.Err() == nil {
+			opts.logger().Warnf("[twitter] replayed connection ended with a bad payload, skipping to the next connection: %v", err)
+		}
+
+		// the rest of a connection that failed to decode is dropped
+		connection.Close()
+	}
+
+	return <-done
+}
+
+// replayCapture writes the data of the records of files to a pipe per
+// connection, sent to connections
+func replayCapture(ctx context.Context, files []string, speed float64, connections chan<- *io.PipeReader) error {
+	var writer *io.PipeWriter
+	connect := func() error {
+		if writer != nil {
+			writer.Close()
+		}
+
+		var reader *io.PipeReader
+		reader, writer = io.Pipe()
+		select {
+		case connections <- reader:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	defer func() {
+		if writer != nil {
+			writer.Close()
+		}
+	}()
+
+	var previous time.Time
+	for _, fileName := range files {
+		f, err := os.Open(fileName)
+		if err != nil {
+			return err
+		}
+
+		scanner := bufio.NewScanner(f)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			var record CaptureRecord
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				f.Close()
+				return fmt.Errorf("%s: %w", fileName, err)
+			}
+
+			if speed > 0 && !previous.IsZero() && record.At.After(previous) {
+				wait := time.Duration(float64(record.At.Sub(previous)) / speed)
+				if err := sleepContext(ctx, wait); err != nil {
+					f.Close()
+					return err
+				}
+			}
+			previous = record.At
+
+			// captures made before connections were marked start with data
+			if record.Connected || writer == nil {
+				if err := connect(); err != nil {
+					f.Close()
+					return err
+				}
+			}
+
+			if len(record.Data) > 0 {
+				// the reader only fails once it gave up on the connection
+				writer.Write(record.Data)
+			}
+		}
+
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("%s: %w", fileName, err)
+		}
+	}
+
+	return nil
+}
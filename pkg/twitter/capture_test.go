@@ -0,0 +1,152 @@
+package twitter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func tweetPayload(id string) []byte {
+	return []byte(fmt.Sprintf("{\"data\":{\"id\":%q,\"text\":\"tweet %s\"}}\r\n", id, id))
+}
+
+// replayed returns the ids of the tweets replayed from paths
+func replayed(t *testing.T, paths []string, speed float64) []string {
+	t.Helper()
+
+	var ids []string
+	err := Replay(context.Background(), paths, speed, StreamOptions{}, func(tweet TweetResponse) {
+		ids = append(ids, tweet.Data.TweetID)
+	})
+	if err != nil {
+		t.Fatalf("Replay returned %v", err)
+	}
+
+	return ids
+}
+
+func TestCaptureWriterRotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.jsonl")
+
+	// every record is longer than half of maxBytes, each file holds one
+	w, err := NewCaptureWriter(path, 100, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 4; i++ {
+		if _, err := w.Write(tweetPayload(fmt.Sprint(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("%s.3 kept beyond the 2 rotated files", path)
+	}
+
+	files := CaptureFiles([]string{path})
+	if want := []string{path + ".2", path + ".1", path}; !reflect.DeepEqual(files, want) {
+		t.Fatalf("CaptureFiles returned %v, want %v", files, want)
+	}
+
+	// the oldest tweet was rotated out
+	if ids := replayed(t, []string{path}, 0); !reflect.DeepEqual(ids, []string{"2", "3", "4"}) {
+		t.Errorf("replayed %v, want [2 3 4]", ids)
+	}
+}
+
+func TestReplaySkipsCutOffConnections(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.jsonl")
+
+	w, err := NewCaptureWriter(path, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.MarkConnection()
+	w.Write(tweetPayload("1"))
+	w.Write([]byte("\r\n"))
+	w.Write([]byte(`{"data":{"id":"2","te`))
+	w.MarkConnection()
+	w.Write(tweetPayload("3"))
+	w.MarkConnection()
+	w.Write([]byte("{not json}\r\n"))
+	w.Write(tweetPayload("4"))
+	w.MarkConnection()
+	w.Write(tweetPayload("5"))
+	w.Close()
+
+	if ids := replayed(t, []string{path}, 0); !reflect.DeepEqual(ids, []string{"1", "3", "5"}) {
+		t.Errorf("replayed %v, want [1 3 5]", ids)
+	}
+}
+
+func TestReplayRoutesErrorObjects(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.jsonl")
+
+	w, err := NewCaptureWriter(path, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.MarkConnection()
+	w.Write([]byte(`{"errors":[{"title":"operational-disconnect","disconnect_type":"UpstreamOperationalDisconnect","type":"https://api.twitter.com/2/problems/operational-disconnect"}]}` + "\r\n"))
+	w.Write(tweetPayload("1"))
+	w.Close()
+
+	var streamErrs []*StreamError
+	var ids []string
+	err = Replay(context.Background(), []string{path}, 0, StreamOptions{
+		OnError: func(streamErr *StreamError) { streamErrs = append(streamErrs, streamErr) },
+	}, func(tweet TweetResponse) { ids = append(ids, tweet.Data.TweetID) })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(streamErrs) != 1 || !streamErrs[0].Disconnect() {
+		t.Errorf("OnError received %v, want one operational disconnect", streamErrs)
+	}
+	if !reflect.DeepEqual(ids, []string{"1"}) {
+		t.Errorf("replayed %v, want [1]", ids)
+	}
+}
+
+func TestReplayPacing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.jsonl")
+
+	// records 200ms apart
+	start := time.Now()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		line, _ := json.Marshal(CaptureRecord{At: start.Add(time.Duration(i) * 200 * time.Millisecond), Data: tweetPayload(fmt.Sprint(i))})
+		f.Write(append(line, '\n'))
+	}
+	f.Close()
+
+	tests := []struct {
+		speed    float64
+		min, max time.Duration
+	}{
+		{speed: 0, max: 100 * time.Millisecond},
+		{speed: 4, min: 100 * time.Millisecond, max: 400 * time.Millisecond},
+		{speed: 1, min: 400 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		began := time.Now()
+		if ids := replayed(t, []string{path}, tt.speed); len(ids) != 3 {
+			t.Fatalf("replayed %v at %gx, want 3 tweets", ids, tt.speed)
+		}
+
+		took := time.Since(began)
+		if took < tt.min || (tt.max > 0 && took > tt.max) {
+			t.Errorf("replay at %gx took %s, want between %s and %s", tt.speed, took, tt.min, tt.max)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package twitter
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/its-rav/makima/pkg/config"
+)
+
+const (
+	DefaultBaseURL   = "https://api.twitter.com"
+	DefaultUserAgent = "makima"
+)
+
+// Client holds everything needed to talk to the Twitter API, BaseURL can
+// point to a proxy, a mirror or a local fake server
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	// BearerToken is used when Tokens is nil
+	BearerToken string
+	Tokens      TokenProvider
+	UserAgent   string
+	// RateLimiter paces the requests, DefaultRateLimiter when nil
+	RateLimiter *RateLimiter
+}
+
+// NewClient returns a client for the public Twitter API
+func NewClient(bearerToken string) *Client {
+	return &Client{
+		BaseURL:     DefaultBaseURL,
+		HTTPClient:  &http.Client{},
+		BearerToken: bearerToken,
+		UserAgent:   DefaultUserAgent,
+	}
+}
+
+// NewClientFromConfig returns a client honouring the base URL and user agent
+// overrides of cfg, the bearer token is left empty
+func NewClientFromConfig(cfg config.TwitterConfig) *Client {
+	client := NewClient("")
+	if cfg.BaseURL != "" {
+		client.BaseURL = cfg.BaseURL
+	}
+	if cfg.UserAgent != "" {
+		client.UserAgent = cfg.UserAgent
+	}
+
+	return client
+}
+
+func (c *Client) url(path string) string {
+	return strings.TrimSuffix(c.BaseURL, "/") + path
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient == nil {
+		return http.DefaultClient
+	}
+
+	return c.HTTPClient
+}
+
+func (c *Client) rateLimiter() *RateLimiter {
+	if c.RateLimiter == nil {
+		return DefaultRateLimiter
+	}
+
+	return c.RateLimiter
+}
+
+// do sends req once its endpoint has requests left and records the rate
+// limit window reported by the response
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	endpoint := rateLimitEndpoint(req)
+	if err := c.rateLimiter().Wait(req.Context(), endpoint); err != nil {
+		return nil, err
+	}
+
+	return c.send(req, endpoint)
+}
+
+// send is do for callers that already waited for the rate limiter
+func (c *Client) send(req *http.Request, endpoint string) (*http.Response, error) {
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	c.rateLimiter().Record(endpoint, resp.Header)
+
+	return resp, nil
+}
+
+func (c *Client) bearerToken(ctx context.Context) (string, error) {
+	if c.Tokens == nil {
+		return c.BearerToken, nil
+	}
+
+	return c.Tokens.Token(ctx)
+}
+
+// resetToken drops a rejected token when the provider can issue a new one,
+// reporting whether retrying makes sense
+func (c *Client) resetToken(ctx context.Context) bool {
+	resetter, ok := c.Tokens.(interface {
+		Reset(ctx context.Context) error
+	})
+
+	return ok && resetter.Reset(ctx) == nil
+}
+
+// newRequest builds a request to path authenticated with the bearer token
+func (c *Client) newRequest(ctx context.Context, method string, path string, body io.Reader) (*http.Request, error) {
+	bearerToken, err := c.bearerToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.url(path), body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", bearerToken))
+
+	req.Header.Set("Content-type", "application/json")
+
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+
+	return req, nil
+}
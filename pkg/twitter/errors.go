@@ -0,0 +1,144 @@
+package twitter
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrStreamClosed is returned when the server ends the stream response
+	ErrStreamClosed = errors.New("twitter: stream closed by server")
+	// ErrStreamStalled is returned when nothing, not even a keep-alive, was
+	// received within the stall timeout
+	ErrStreamStalled = errors.New("twitter: stream stalled")
+
+	// ErrUnauthorized matches an *HTTPError with status 401
+	ErrUnauthorized = errors.New("twitter: unauthorized")
+	// ErrForbidden matches an *HTTPError with status 403
+	ErrForbidden = errors.New("twitter: forbidden")
+	// ErrRateLimited matches an *HTTPError with status 429
+	ErrRateLimited = errors.New("twitter: rate limited")
+)
+
+// HTTPError is returned when the Twitter API answers with a non-2xx status
+type HTTPError struct {
+	StatusCode int
+	Status     string
+	Body       string
+	// RateLimitReset is parsed from the x-rate-limit-reset header, zero if absent
+	RateLimitReset time.Time
+}
+
+func (e *HTTPError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("twitter: unexpected response %s", e.Status)
+	}
+
+	return fmt.Sprintf("twitter: unexpected response %s: %s", e.Status, e.Body)
+}
+
+// Is lets errors.Is match an *HTTPError against the status sentinels
+func (e *HTTPError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	}
+
+	return false
+}
+
+func newHTTPError(resp *http.Response, body []byte) *HTTPError {
+	httpErr := &HTTPError{
+		StatusCode: resp.StatusCode,
+		Status:     resp.Status,
+		Body:       string(body),
+	}
+
+	if reset, err := strconv.ParseInt(resp.Header.Get("x-rate-limit-reset"), 10, 64); err == nil {
+		httpErr.RateLimitReset = time.Unix(reset, 0)
+	}
+
+	return httpErr
+}
+
+// RulesError is returned when the rules endpoint rejects some of the rules
+type RulesError struct {
+	Errors []APIError
+}
+
+func (e *RulesError) Error() string {
+	var details []string
+	for _, apiErr := range e.Errors {
+		detail := apiErr.Title
+		if apiErr.Value != "" {
+			detail = fmt.Sprintf("%s (%s)", detail, apiErr.Value)
+		}
+		details = append(details, detail)
+	}
+
+	return fmt.Sprintf("twitter: %d rule(s) rejected: %s", len(e.Errors), strings.Join(details, "; "))
+}
+
+func (resp CommandStreamRulesResponse) err() error {
+	if len(resp.Errors) == 0 {
+		return nil
+	}
+
+	return &RulesError{Errors: resp.Errors}
+}
+
+// problem types of the error objects sent on the stream
+const (
+	problemOperationalDisconnect = "https://api.twitter.com/2/problems/operational-disconnect"
+	problemStreamingConnection   = "https://api.twitter.com/2/problems/streaming-connection"
+)
+
+// StreamError holds the error objects sent on the stream instead of a tweet,
+// e.g. operational disconnects, connection errors or rule matching failures
+type StreamError struct {
+	Errors []APIError
+}
+
+func (e *StreamError) Error() string {
+	var details []string
+	for _, apiErr := range e.Errors {
+		detail := apiErr.Title
+		if apiErr.Detail != "" {
+			detail = fmt.Sprintf("%s: %s", detail, apiErr.Detail)
+		}
+		details = append(details, detail)
+	}
+
+	return fmt.Sprintf("twitter: stream error: %s", strings.Join(details, "; "))
+}
+
+// Disconnect reports whether the server is about to close the connection
+func (e *StreamError) Disconnect() bool {
+	for _, apiErr := range e.Errors {
+		if apiErr.Type == problemOperationalDisconnect || apiErr.DisconnectType != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// TooManyConnections reports whether the connection was refused because the
+// connection limit of the app is reached
+func (e *StreamError) TooManyConnections() bool {
+	for _, apiErr := range e.Errors {
+		if apiErr.ConnectionIssue == "TooManyConnections" || (apiErr.Type == problemStreamingConnection && apiErr.Title == "ConnectionException") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,19 @@
+package twitter
+
+import "time"
+
+// SetBackoff replaces the reconnect schedules with a constant wait, the
+// returned func restores them
+func SetBackoff(wait time.Duration) (restore func()) {
+	saved := []time.Duration{networkBackoffStep, networkBackoffMax, httpBackoffMin, httpBackoffMax, rateLimitBackoffMin, rateLimitBackoffMax}
+
+	networkBackoffStep, networkBackoffMax = wait, wait
+	httpBackoffMin, httpBackoffMax = wait, wait
+	rateLimitBackoffMin, rateLimitBackoffMax = wait, wait
+
+	return func() {
+		networkBackoffStep, networkBackoffMax = saved[0], saved[1]
+		httpBackoffMin, httpBackoffMax = saved[2], saved[3]
+		rateLimitBackoffMin, rateLimitBackoffMax = saved[4], saved[5]
+	}
+}
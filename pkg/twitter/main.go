@@ -2,16 +2,13 @@ package twitter
 
 import (
 	"bytes"
-	"encoding/base64"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"net/http"
 	"reflect"
-	"strconv"
 	"strings"
-	"time"
 )
 
 func convertStructToQueryParams(params interface{}) string {
@@ -48,389 +45,99 @@ func convertStructToQueryParams(params interface{}) string {
 	return strings.Join(queryParams, "&")
 }
 
-// function to get the bearer token
-func GetBearerToken(consumerKey string, consumerSecret string) string {
-	keySecretConcat := fmt.Sprintf("%s:%s", consumerKey, consumerSecret)
-	b64Encoded := base64.StdEncoding.EncodeToString([]byte(keySecretConcat))
+const streamRulesPath = "/2/tweets/search/stream/rules"
 
-	authURL := "https://api.twitter.com/oauth2/token"
-	authHeader := fmt.Sprintf("Basic %s", b64Encoded)
-
-	reqBody := []byte("grant_type=client_credentials")
-	req, err := http.NewRequest("POST", authURL, bytes.NewBuffer(reqBody))
-	if err != nil {
-		// handle error
-	}
-
-	req.Header.Set("Authorization", authHeader)
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded;charset=UTF-8")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		// handle error
-	}
-	defer resp.Body.Close()
+// doJSONRequest sends a request to path and decodes the JSON response into out
+func (c *Client) doJSONRequest(method string, path string, data interface{}, out interface{}) error {
+	return c.doJSONRequestContext(context.Background(), method, path, data, out)
+}
 
-	bodyBytes, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		// handle error
+func (c *Client) doJSONRequestContext(ctx context.Context, method string, path string, data interface{}, out interface{}) error {
+	var body io.Reader
+	if data != nil {
+		bodyBytes, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewBuffer(bodyBytes)
 	}
 
-	authResp := struct {
-		TokenType   string `json:"token_type"`
-		AccessToken string `json:"access_token"`
-	}{}
-	_ = json.Unmarshal(bodyBytes, &authResp)
-
-	return authResp.AccessToken
-}
-
-// get stream rules with httpClient and bearerToken
-func getStreamRules(httpClient *http.Client, bearerToken string) GetStreamRulesResponse {
-	url := "https://api.twitter.com/2/tweets/search/stream/rules"
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := c.newRequest(ctx, method, path, body)
 	if err != nil {
-		// handle error
-		fmt.Println(err)
+		return err
 	}
 
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", bearerToken))
-
-	req.Header.Set("Content-type", "application/json")
-
-	resp, err := httpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
-		// handle error
+		return err
 	}
 
 	defer resp.Body.Close()
 
-	getResponseHeaders(resp, []string{"x-rate-limit-limit", "x-rate-limit-remaining", "x-rate-limit-reset"})
-
 	bodyBytes, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		// handle error
-		fmt.Println(err)
-	}
-
-	var getStreamRulesResponse GetStreamRulesResponse
-	_ = json.Unmarshal(bodyBytes, &getStreamRulesResponse)
-
-	return getStreamRulesResponse
-}
-
-// get response headers with given keys
-func getResponseHeaders(resp *http.Response, keys []string) map[string]string {
-	headers := make(map[string]string)
-	for _, key := range keys {
-		headers[key] = resp.Header.Get(key)
+		return err
 	}
 
-	// print headers
-	for key, value := range headers {
-		fmt.Printf("%s: %s", key, value)
-		fmt.Println()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return newHTTPError(resp, bodyBytes)
 	}
 
-	return headers
+	return json.Unmarshal(bodyBytes, out)
 }
 
-func doPostAddStreamRules(httpClient *http.Client, bearerToken string, data AddStreamRulesRequest) CommandStreamRulesResponse {
-	url := "https://api.twitter.com/2/tweets/search/stream/rules"
-	req, err := http.NewRequest("POST", url, nil)
-	if err != nil {
-		// handle error
-		fmt.Println(err)
-	}
-
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", bearerToken))
-
-	req.Header.Set("Content-type", "application/json")
-
-	bodyBytes, err := json.Marshal(data)
-	if err != nil {
-		// handle error
-		fmt.Println(err)
-	}
-
-	fmt.Println(string(bodyBytes))
-
-	req.Body = ioutil.NopCloser(bytes.NewBuffer(bodyBytes))
-
-	resp, err := httpClient.Do(req)
-
-	if err != nil {
-		// print error
-		fmt.Println(err)
-	}
-
-	defer resp.Body.Close()
-
-	getResponseHeaders(resp, []string{"x-rate-limit-limit", "x-rate-limit-remaining", "x-rate-limit-reset"})
-
-	bodyBytes, err = ioutil.ReadAll(resp.Body)
-	if err != nil {
-		// handle error
-	}
-
-	// print response body, status code
-	fmt.Println(string(bodyBytes))
-	fmt.Println(resp.StatusCode)
-
-	var commandStreamRulesResponse CommandStreamRulesResponse
-	_ = json.Unmarshal(bodyBytes, &commandStreamRulesResponse)
+// GetStreamRules returns the active stream rules
+func (c *Client) GetStreamRules() (GetStreamRulesResponse, error) {
+	var getStreamRulesResponse GetStreamRulesResponse
+	err := c.doJSONRequest("GET", streamRulesPath, nil, &getStreamRulesResponse)
 
-	return commandStreamRulesResponse
+	return getStreamRulesResponse, err
 }
 
-func doPostDeleteStreamRules(httpClient *http.Client, bearerToken string, data DeleteStreamRulesRequest) CommandStreamRulesResponse {
-	url := "https://api.twitter.com/2/tweets/search/stream/rules"
-	req, err := http.NewRequest("POST", url, nil)
-	if err != nil {
-		// handle error
-		fmt.Println(err)
-	}
-
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", bearerToken))
-
-	req.Header.Set("Content-type", "application/json")
-
-	bodyBytes, err := json.Marshal(data)
-	if err != nil {
-		// handle error
-		fmt.Println(err)
-	}
-
-	fmt.Println(string(bodyBytes))
-
-	req.Body = ioutil.NopCloser(bytes.NewBuffer(bodyBytes))
-
-	resp, err := httpClient.Do(req)
-
-	if err != nil {
-		// print error
-		fmt.Println(err)
-	}
-
-	defer resp.Body.Close()
-
-	getResponseHeaders(resp, []string{"x-rate-limit-limit", "x-rate-limit-remaining", "x-rate-limit-reset"})
-
-	bodyBytes, err = ioutil.ReadAll(resp.Body)
-	if err != nil {
-		// handle error
-	}
-
-	// print response body, status code
-	fmt.Println(string(bodyBytes))
-	fmt.Println(resp.StatusCode)
-
-	var commandStreamRulesResponse CommandStreamRulesResponse
-	_ = json.Unmarshal(bodyBytes, &commandStreamRulesResponse)
+// AddStreamRules adds rules to the stream
+func (c *Client) AddStreamRules(rules []AddStreamRule) (CommandStreamRulesResponse, error) {
+	return c.postAddStreamRules(rules, false)
+}
 
-	return commandStreamRulesResponse
+// ValidateStreamRules checks rules with the API without adding them
+func (c *Client) ValidateStreamRules(rules []AddStreamRule) (CommandStreamRulesResponse, error) {
+	return c.postAddStreamRules(rules, true)
 }
 
-// add stream rules
-func addStreamRules(httpClient *http.Client, bearerToken string, rules []AddStreamRule) CommandStreamRulesResponse {
+func (c *Client) postAddStreamRules(rules []AddStreamRule, dryRun bool) (CommandStreamRulesResponse, error) {
 
 	// create CommandStreamRulesRequest
 	data := AddStreamRulesRequest{
 		Add: rules,
 	}
 
-	commandStreamRulesResponse := doPostAddStreamRules(httpClient, bearerToken, data)
+	path := streamRulesPath
+	if dryRun {
+		path += "?dry_run=true"
+	}
+
+	var commandStreamRulesResponse CommandStreamRulesResponse
+	err := c.doJSONRequest("POST", path, data, &commandStreamRulesResponse)
+	if err == nil {
+		err = commandStreamRulesResponse.err()
+	}
 
-	return commandStreamRulesResponse
+	return commandStreamRulesResponse, err
 }
 
-// remove stream rules
-func deleteStreamRules(httpClient *http.Client, bearerToken string, ids []string) CommandStreamRulesResponse {
+// DeleteStreamRules removes the rules with the given ids
+func (c *Client) DeleteStreamRules(ids []string) (CommandStreamRulesResponse, error) {
 	data := DeleteStreamRulesRequest{
 		Delete: DeleteStreamRulesAction{
 			Ids: ids,
 		},
 	}
 
-	commandStreamRulesResponse := doPostDeleteStreamRules(httpClient, bearerToken, data)
-
-	return commandStreamRulesResponse
-}
-
-func OnStreamReceived(bearerToken string, params GetStreamQueryParams, callback func(tweet TweetResponse)) {
-	// init http client
-	httpClient := &http.Client{}
-
-	var queryParams string = convertStructToQueryParams(params)
-
-	// call to https://api.twitter.com/2/tweets/search/stream which is a stream endpoint
-
-	// init request
-	url := fmt.Sprintf("https://api.twitter.com/2/tweets/search/stream?%s", queryParams)
-
-	fmt.Printf("url: %s", url)
-	fmt.Println()
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		// handle error
-		fmt.Println(err)
-	}
-
-	// set headers
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", bearerToken))
-
-	req.Header.Set("Content-type", "application/json")
-
-	// loop stream while avoid rate limit
-	// perform a number of ( x-rate-limit-remaining ) requests
-	// in a given time window ( now - x-rate-limit-reset ) seconds
-	// or wait until the time window is over
-	for {
-		resp, err := httpClient.Do(req)
-
-		if err != nil {
-			// print error
-			fmt.Println("Err send request")
-			fmt.Println(err)
-		}
-
-		headers := getResponseHeaders(resp, []string{"x-rate-limit-limit", "x-rate-limit-remaining", "x-rate-limit-reset"})
-
-		// read response body
-		dec := json.NewDecoder(resp.Body)
-		for {
-			var tweetResponse TweetResponse
-			err := dec.Decode(&tweetResponse)
-			if err != nil {
-				if err == io.EOF {
-					break
-				}
-			}
-
-			fmt.Println("-------------------------")
-			fmt.Println(tweetResponse)
-			fmt.Println("-------------------------")
-
-			callback(tweetResponse)
-		}
-
-		// print response body, status code
-		// fmt.Println(string(bodyBytes))
-
-		//parse remaining requests
-
-		defer resp.Body.Close()
-		remaining, _ := strconv.ParseInt(headers["x-rate-limit-remaining"], 10, 64)
-		reset, _ := strconv.ParseInt(headers["x-rate-limit-reset"], 10, 64)
-		timeWindow := reset - time.Now().Unix()
-
-		// check if rate limit is reached
-		if remaining > 0 {
-			// display remaining requests in time window
-			fmt.Printf("Remaining requests: %d, in time window: %d seconds", remaining, timeWindow)
-			fmt.Println()
-
-			timeWait := time.Duration(timeWindow)*time.Second/time.Duration(remaining) + 500*time.Millisecond
-			fmt.Printf("Waiting %s seconds", timeWait)
-			fmt.Println()
-
-			// time sleep miliseconds
-
-		} else {
-			// get current time
-			now := time.Now().Unix()
-
-			// get reset time
-
-			// get time to wait
-			wait := reset - now
-
-			// wait until time window is over
-			time.Sleep(time.Duration(wait)*time.Second + 1*time.Second)
-		}
-
-		// first time only
-		break
-	}
-}
-
-func overrideStreamRules(consumerKey string, consumerSecret string) {
-
-	bearerToken := GetBearerToken(consumerKey, consumerSecret)
-
-	fmt.Println(bearerToken)
-	// init http client
-	httpClient := &http.Client{}
-
-	// getStreamRules(bearerToken)
-	fmt.Println("Getting stream rules")
-	rules := getStreamRules(httpClient, bearerToken)
-	fmt.Println(rules)
-	// print rules line by line
-	for _, rule := range rules.Data {
-		fmt.Println(rule)
-	}
-
-	// get ids of rules to delete
-	var ids []string
-	for _, rule := range rules.Data {
-		ids = append(ids, rule.ID)
-	}
-
-	// check if there are rules to delete
-	if len(ids) > 0 {
-		// delete rules
-		fmt.Println("Delete stream rules")
-		deleteStreamRules(httpClient, bearerToken, ids)
-	}
-
-	// add new rules
-	// accept list of string and append to string to string split with space
-	var newRulesAdding []string = []string{
-		"from:VitalikButerin",
-		"from:cz_binance",
-		"from:WatcherGuru",
-		"from:0xfoobar",
-		"from:0xQuit",
-		"from:0xCygaar",
-		"from:tier10k",
-		"from:whale_alert",
-		"from:brian_armstrong",
-		"from:unusual_whales",
-		"from:Tree_of_Alpha",
-		"from:elonmusk",
-		"from:const_phoenixed",
-		"from:hyuktrades",
-		"from:News_Of_Alpha",
-		"from:GCRClassic",
-		"from:CryptoCapo_",
-		"from:HsakaTrades",
-		"from:AlgodTrading",
-	}
-
-	value := strings.Join(newRulesAdding, " OR ")
-
-	var addStreamRulesResponse CommandStreamRulesResponse
-
-	fmt.Println("Add stream rules")
-	addStreamRulesResponse = addStreamRules(httpClient, bearerToken, []AddStreamRule{
-		{
-			Value: value,
-		},
-	})
-	// addStreamRulesResponse to string and print
-	fmt.Println(addStreamRulesResponse)
-
-	fmt.Println("Get stream rules")
-	newRules := getStreamRules(httpClient, bearerToken)
-	fmt.Println(newRules)
-	// print rules line by line
-	for _, rule := range newRules.Data {
-		fmt.Println(rule)
+	var commandStreamRulesResponse CommandStreamRulesResponse
+	err := c.doJSONRequest("POST", streamRulesPath, data, &commandStreamRulesResponse)
+	if err == nil {
+		err = commandStreamRulesResponse.err()
 	}
 
-	// exit program
-	return
+	return commandStreamRulesResponse, err
 }
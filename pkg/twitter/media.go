@@ -0,0 +1,74 @@
+package twitter
+
+import "strings"
+
+const contentTypeMP4 = "video/mp4"
+
+// IsVideo reports whether the media is a video or an animated GIF, both are
+// delivered as MP4 variants
+func (m Media) IsVideo() bool {
+	return m.Type == MediaVideo || m.Type == MediaAnimatedGIF
+}
+
+// ImageURL returns the picture to display for the media, the preview image
+// for videos and animated GIFs whose URL is empty
+func (m Media) ImageURL() string {
+	if m.URL != "" {
+		return m.URL
+	}
+
+	return m.PreviewImageURL
+}
+
+// EstimatedSize returns the approximate size in bytes of a variant, 0 when
+// the bit rate or the duration is unknown
+func (m Media) EstimatedSize(variant MediaVariant) int64 {
+	return int64(variant.BitRate) * int64(m.DurationMS) / 8000
+}
+
+// BestVariant returns the MP4 variant with the highest bit rate whose
+// estimated size is at most maxBytes, any size is accepted when maxBytes <= 0
+func (m Media) BestVariant(maxBytes int64) (MediaVariant, bool) {
+	var best MediaVariant
+	var found bool
+	for _, variant := range m.Variants {
+		if !strings.HasPrefix(variant.ContentType, contentTypeMP4) {
+			continue
+		}
+		if maxBytes > 0 && m.EstimatedSize(variant) > maxBytes {
+			continue
+		}
+		if !found || variant.BitRate > best.BitRate {
+			best = variant
+			found = true
+		}
+	}
+
+	return best, found
+}
+
+// Photos returns the expanded photos of the tweet in the order they are
+// attached, followed by any photo missing from attachments.media_keys
+func (resp *TweetResponse) Photos() []Media {
+	var photos []Media
+	seen := make(map[string]bool)
+	if resp.Data.Attachments != nil {
+		for _, key := range resp.Data.Attachments.MediaKeys {
+			for _, media := range resp.Includes.Media {
+				if media.MediaKey == key && media.Type == MediaPhoto && !seen[key] {
+					seen[key] = true
+					photos = append(photos, media)
+				}
+			}
+		}
+	}
+
+	for _, media := range resp.Includes.Media {
+		if media.Type == MediaPhoto && !seen[media.MediaKey] {
+			seen[media.MediaKey] = true
+			photos = append(photos, media)
+		}
+	}
+
+	return photos
+}
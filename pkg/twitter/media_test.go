@@ -0,0 +1,65 @@
+package twitter
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMediaBestVariant(t *testing.T) {
+	// 10s, 256kbps weighs 320kB and 2Mbps 2.5MB
+	video := Media{
+		Type:       MediaVideo,
+		DurationMS: 10000,
+		Variants: []MediaVariant{
+			{ContentType: "application/x-mpegURL", URL: "https://video.twimg.com/playlist.m3u8"},
+			{BitRate: 256000, ContentType: "video/mp4", URL: "https://video.twimg.com/256.mp4"},
+			{BitRate: 2176000, ContentType: "video/mp4", URL: "https://video.twimg.com/2176.mp4"},
+			{BitRate: 832000, ContentType: "video/mp4", URL: "https://video.twimg.com/832.mp4"},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		media    Media
+		maxBytes int64
+		want     string
+	}{
+		{name: "any size", media: video, maxBytes: 0, want: "https://video.twimg.com/2176.mp4"},
+		{name: "under the limit", media: video, maxBytes: 2 << 20, want: "https://video.twimg.com/832.mp4"},
+		{name: "none under the limit", media: video, maxBytes: 100000},
+		// animated GIFs have a single variant without bit rate or duration
+		{name: "animated GIF", media: Media{Type: MediaAnimatedGIF, Variants: []MediaVariant{{ContentType: "video/mp4", URL: "https://video.twimg.com/gif.mp4"}}}, maxBytes: 8 << 20, want: "https://video.twimg.com/gif.mp4"},
+		{name: "playlist only", media: Media{Type: MediaVideo, Variants: video.Variants[:1]}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			variant, ok := tt.media.BestVariant(tt.maxBytes)
+			if ok != (tt.want != "") || variant.URL != tt.want {
+				t.Errorf("BestVariant(%d) = %q, %t, want %q", tt.maxBytes, variant.URL, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestTweetResponsePhotos(t *testing.T) {
+	resp := TweetResponse{
+		Data: TweetData{Attachments: &Attachments{MediaKeys: []string{"3_2", "7_1", "3_1"}}},
+		Includes: TweetInclude{Media: []Media{
+			{MediaKey: "3_1", Type: MediaPhoto},
+			{MediaKey: "3_2", Type: MediaPhoto},
+			{MediaKey: "7_1", Type: MediaVideo},
+			// expanded from a referenced tweet
+			{MediaKey: "3_3", Type: MediaPhoto},
+		}},
+	}
+
+	var keys []string
+	for _, photo := range resp.Photos() {
+		keys = append(keys, photo.MediaKey)
+	}
+
+	if want := []string{"3_2", "3_1", "3_3"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("photos %v, want %v", keys, want)
+	}
+}
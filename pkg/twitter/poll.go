@@ -0,0 +1,378 @@
+package twitter
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/its-rav/makima/pkg/logger"
+)
+
+const (
+	DefaultPollInterval = time.Minute
+	// DefaultPollMaxResults is the largest page the search and timeline
+	// endpoints return
+	DefaultPollMaxResults = 100
+)
+
+// Checkpoints keeps the newest tweet ID seen by a poller under a key, Load
+// returns an empty ID when nothing was stored yet
+type Checkpoints interface {
+	Load(ctx context.Context, key string) (string, error)
+	Store(ctx context.Context, key string, id string) error
+}
+
+// memoryCheckpoints is used when no Checkpoints are configured, they are lost
+// on restart
+type memoryCheckpoints struct {
+	mu  sync.Mutex
+	ids map[string]string
+}
+
+func (m *memoryCheckpoints) Load(ctx context.Context, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.ids[key], nil
+}
+
+func (m *memoryCheckpoints) Store(ctx context.Context, key string, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.ids == nil {
+		m.ids = make(map[string]string)
+	}
+	m.ids[key] = id
+
+	return nil
+}
+
+// PollOptions tunes the behaviour of the polling collectors
+type PollOptions struct {
+	// Logger receives poll and retry events, discarded when nil
+	Logger logger.Logger
+	// Interval is the delay between two polls, DefaultPollInterval when zero
+	Interval time.Duration
+	// MaxResults is the page size, DefaultPollMaxResults when zero
+	MaxResults int
+	// Checkpoints persists since_id between restarts, kept in memory when nil.
+	// Without a checkpoint only the tweets posted since polling started are
+	// published.
+	Checkpoints Checkpoints
+}
+
+func (o PollOptions) logger() logger.Logger {
+	if o.Logger == nil {
+		return logger.NopLogger{}
+	}
+
+	return o.Logger
+}
+
+func (o PollOptions) interval() time.Duration {
+	if o.Interval <= 0 {
+		return DefaultPollInterval
+	}
+
+	return o.Interval
+}
+
+func (o PollOptions) maxResults() int {
+	if o.MaxResults <= 0 {
+		return DefaultPollMaxResults
+	}
+
+	return o.MaxResults
+}
+
+// TweetsMeta is the pagination of a tweets page
+type TweetsMeta struct {
+	NewestID    string `json:"newest_id"`
+	OldestID    string `json:"oldest_id"`
+	ResultCount int    `json:"result_count"`
+	NextToken   string `json:"next_token"`
+}
+
+// TweetsResponse is a page of tweets returned by the search and timeline
+// endpoints, newest first
+type TweetsResponse struct {
+	Data     []TweetData  `json:"data"`
+	Includes TweetInclude `json:"includes"`
+	Errors   []APIError   `json:"errors,omitempty"`
+	Meta     TweetsMeta   `json:"meta"`
+}
+
+// Tweets splits the page into one TweetResponse per tweet, oldest first,
+// each with the includes it expands to. The tweets are given a matching rule
+// with tag, as if they had been received on the stream.
+func (page TweetsResponse) Tweets(tag string) []TweetResponse {
+	var tweets []TweetResponse
+	for i := len(page.Data) - 1; i >= 0; i-- {
+		tweet := TweetResponse{
+			Data:     page.Data[i],
+			Includes: page.includesOf(page.Data[i]),
+		}
+		if tag != "" {
+			tweet.MatchingRules = []MatchingRule{{Tag: tag}}
+		}
+		tweets = append(tweets, tweet)
+	}
+
+	return tweets
+}
+
+// includesOf picks the page includes tweet expands to: its media, poll and
+// place, the tweets it references and the users it or they refer to
+func (page TweetsResponse) includesOf(tweet TweetData) TweetInclude {
+	var includes TweetInclude
+
+	tweetIDs := make(map[string]bool)
+	for _, ref := range tweet.ReferencedTweets {
+		tweetIDs[ref.ID] = true
+	}
+	for _, included := range page.Includes.Tweets {
+		if tweetIDs[included.TweetID] {
+			includes.Tweets = append(includes.Tweets, included)
+		}
+	}
+
+	userIDs := map[string]bool{tweet.AuthorID: true}
+	if tweet.InReplyToUserID != "" {
+		userIDs[tweet.InReplyToUserID] = true
+	}
+	for _, mention := range tweet.Entities.Mentions {
+		userIDs[mention.ID] = true
+	}
+	for _, referenced := range includes.Tweets {
+		userIDs[referenced.AuthorID] = true
+	}
+	for _, user := range page.Includes.Users {
+		if userIDs[user.ID] {
+			includes.Users = append(includes.Users, user)
+		}
+	}
+
+	if tweet.Attachments != nil {
+		mediaKeys := make(map[string]bool)
+		for _, key := range tweet.Attachments.MediaKeys {
+			mediaKeys[key] = true
+		}
+		for _, media := range page.Includes.Media {
+			if mediaKeys[media.MediaKey] {
+				includes.Media = append(includes.Media, media)
+			}
+		}
+
+		pollIDs := make(map[string]bool)
+		for _, id := range tweet.Attachments.PollIDs {
+			pollIDs[id] = true
+		}
+		for _, poll := range page.Includes.Polls {
+			if pollIDs[poll.ID] {
+				includes.Polls = append(includes.Polls, poll)
+			}
+		}
+	}
+
+	if tweet.Geo != nil && tweet.Geo.PlaceID != "" {
+		for _, place := range page.Includes.Places {
+			if place.ID == tweet.Geo.PlaceID {
+				includes.Places = append(includes.Places, place)
+			}
+		}
+	}
+
+	return includes
+}
+
+// pollQueryParams selects the same fields as the stream, backfill only
+// applies to the stream
+func pollQueryParams(params GetStreamQueryParams) url.Values {
+	params.BackfillMinutes = 0
+	values, _ := url.ParseQuery(convertStructToQueryParams(params))
+
+	return values
+}
+
+// poller fetches the new tweets of the keys polled by a collector. Keys
+// without a checkpoint start from the time they are first polled, so that a
+// first run or a restart without stored checkpoints does not publish the
+// history.
+type poller struct {
+	client      *Client
+	opts        PollOptions
+	checkpoints Checkpoints
+
+	mu    sync.Mutex
+	since map[string]time.Time
+}
+
+func (c *Client) newPoller(opts PollOptions) *poller {
+	checkpoints := opts.Checkpoints
+	if checkpoints == nil {
+		checkpoints = &memoryCheckpoints{}
+	}
+
+	return &poller{
+		client:      c,
+		opts:        opts,
+		checkpoints: checkpoints,
+		since:       make(map[string]time.Time),
+	}
+}
+
+// startTime returns when the polling of key without checkpoint started, the
+// API refuses a start_time within the last 10 seconds
+func (p *poller) startTime(key string) time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	since, ok := p.since[key]
+	if !ok {
+		since = time.Now()
+		p.since[key] = since
+	}
+
+	if latest := time.Now().Add(-10 * time.Second); since.After(latest) {
+		return latest
+	}
+
+	return since
+}
+
+// restart drops the checkpoint of key, it is polled from now on
+func (p *poller) restart(ctx context.Context, key string) error {
+	p.mu.Lock()
+	p.since[key] = time.Now()
+	p.mu.Unlock()
+
+	return p.checkpoints.Store(ctx, key, "")
+}
+
+// poll fetches the tweets of path newer than the checkpoint under key and
+// invokes callback for each of them oldest first. The checkpoint is only
+// moved once every tweet was delivered. A checkpoint the API no longer
+// accepts, e.g. older than the 7 days recent search covers, is dropped.
+func (p *poller) poll(ctx context.Context, path string, query url.Values, key string, tag string, callback func(tweet TweetResponse)) error {
+	sinceID, err := p.checkpoints.Load(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	pages, err := p.fetch(ctx, path, query, key, sinceID)
+	if isInvalidStart(err) {
+		p.opts.logger().Warnf("[twitter] %s cannot be polled from %s any more, starting again from now: %v", key, sinceID, err)
+		return p.restart(ctx, key)
+	}
+	if err != nil {
+		return err
+	}
+
+	newestID := pages[0].Meta.NewestID
+	if newestID == "" {
+		return nil
+	}
+
+	for i := len(pages) - 1; i >= 0; i-- {
+		for _, tweet := range pages[i].Tweets(tag) {
+			callback(tweet)
+		}
+	}
+
+	return p.checkpoints.Store(ctx, key, newestID)
+}
+
+// fetch returns the pages of tweets after sinceID, or after the start time of
+// key without checkpoint, newest first
+func (p *poller) fetch(ctx context.Context, path string, query url.Values, key string, sinceID string) ([]TweetsResponse, error) {
+	var pages []TweetsResponse
+	var nextToken string
+	for {
+		pageQuery := url.Values{}
+		for name, values := range query {
+			pageQuery[name] = values
+		}
+		pageQuery.Set("max_results", strconv.Itoa(p.opts.maxResults()))
+		if sinceID != "" {
+			pageQuery.Set("since_id", sinceID)
+		} else {
+			pageQuery.Set("start_time", p.startTime(key).UTC().Format(time.RFC3339))
+		}
+		if nextToken != "" {
+			pageQuery.Set("pagination_token", nextToken)
+		}
+
+		var page TweetsResponse
+		if err := p.client.doJSONRequestContext(ctx, "GET", path+"?"+pageQuery.Encode(), nil, &page); err != nil {
+			return nil, err
+		}
+		pages = append(pages, page)
+
+		nextToken = page.Meta.NextToken
+		if nextToken == "" {
+			return pages, nil
+		}
+	}
+}
+
+// isInvalidStart reports whether the API refused the since_id or start_time
+// of a poll
+func isInvalidStart(err error) bool {
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusBadRequest {
+		return false
+	}
+
+	return strings.Contains(httpErr.Body, "since_id") || strings.Contains(httpErr.Body, "start_time")
+}
+
+// pollLoop invokes poll every interval until ctx is cancelled. Rate limited
+// polls wait for the limit reset, other failures are logged and retried on
+// the next round, except for the ones retrying cannot fix.
+func pollLoop(ctx context.Context, opts PollOptions, poll func(ctx context.Context) error) error {
+	log := opts.logger()
+
+	for {
+		wait := opts.interval()
+
+		err := poll(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		var httpErr *HTTPError
+		switch {
+		case err == nil:
+		case errors.Is(err, ErrUnauthorized), errors.Is(err, ErrForbidden):
+			return err
+		case errors.Is(err, ErrRateLimited) && errors.As(err, &httpErr) && !httpErr.RateLimitReset.IsZero():
+			wait = time.Until(httpErr.RateLimitReset) + time.Second
+			log.Warnf("[twitter] poll rate limited, resuming in %s", wait)
+		default:
+			log.Warnf("[twitter] poll failed: %v, retrying in %s", err, wait)
+		}
+
+		if err := sleepContext(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// sleepContext waits for d or until ctx is cancelled
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,230 @@
+package twitter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// page of two tweets, the newest quotes a tweet of another user
+const pollPage = `{
+	"data": [
+		{"id": "3", "text": "quote", "author_id": "10", "attachments": {"media_keys": ["3_2"]}, "referenced_tweets": [{"type": "quoted", "id": "1"}], "entities": {"mentions": [{"username": "c", "id": "30"}]}},
+		{"id": "2", "text": "photos", "author_id": "20", "attachments": {"media_keys": ["2_1", "2_2"], "poll_ids": ["p"]}, "geo": {"place_id": "pl"}}
+	],
+	"includes": {
+		"users": [{"id": "10", "username": "a"}, {"id": "20", "username": "b"}, {"id": "30", "username": "c"}, {"id": "40", "username": "d"}],
+		"media": [{"media_key": "2_1", "type": "photo"}, {"media_key": "2_2", "type": "photo"}, {"media_key": "3_2", "type": "video"}],
+		"tweets": [{"id": "1", "text": "quoted", "author_id": "40"}],
+		"polls": [{"id": "p"}],
+		"places": [{"id": "pl", "full_name": "Paris"}]
+	},
+	"meta": {"newest_id": "3", "oldest_id": "2", "result_count": 2}
+}`
+
+func TestTweetsResponseTweets(t *testing.T) {
+	var page TweetsResponse
+	if err := json.Unmarshal([]byte(pollPage), &page); err != nil {
+		t.Fatal(err)
+	}
+
+	tweets := page.Tweets("news")
+	if len(tweets) != 2 {
+		t.Fatalf("%d tweets, want 2", len(tweets))
+	}
+
+	tests := []struct {
+		id     string
+		users  []string
+		media  []string
+		tweets []string
+		polls  int
+		places int
+	}{
+		{id: "2", users: []string{"20"}, media: []string{"2_1", "2_2"}, polls: 1, places: 1},
+		{id: "3", users: []string{"10", "30", "40"}, media: []string{"3_2"}, tweets: []string{"1"}},
+	}
+
+	for i, tt := range tests {
+		tweet := tweets[i]
+		if tweet.Data.TweetID != tt.id {
+			t.Fatalf("tweet %d is %s, want %s", i, tweet.Data.TweetID, tt.id)
+		}
+		if tags := tweet.RuleTags(); !reflect.DeepEqual(tags, []string{"news"}) {
+			t.Errorf("tweet %s tags %v, want [news]", tt.id, tags)
+		}
+
+		var users, media, referenced []string
+		for _, user := range tweet.Includes.Users {
+			users = append(users, user.ID)
+		}
+		for _, m := range tweet.Includes.Media {
+			media = append(media, m.MediaKey)
+		}
+		for _, ref := range tweet.Includes.Tweets {
+			referenced = append(referenced, ref.TweetID)
+		}
+
+		if !reflect.DeepEqual(users, tt.users) {
+			t.Errorf("tweet %s users %v, want %v", tt.id, users, tt.users)
+		}
+		if !reflect.DeepEqual(media, tt.media) {
+			t.Errorf("tweet %s media %v, want %v", tt.id, media, tt.media)
+		}
+		if !reflect.DeepEqual(referenced, tt.tweets) {
+			t.Errorf("tweet %s referenced tweets %v, want %v", tt.id, referenced, tt.tweets)
+		}
+		if len(tweet.Includes.Polls) != tt.polls || len(tweet.Includes.Places) != tt.places {
+			t.Errorf("tweet %s has %d polls and %d places, want %d and %d", tt.id, len(tweet.Includes.Polls), len(tweet.Includes.Places), tt.polls, tt.places)
+		}
+	}
+}
+
+// pollServer answers the polls with respond and records their queries
+type pollServer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	queries []url.Values
+}
+
+func newPollServer(t *testing.T, respond func(query url.Values) (int, string)) (*pollServer, *Client) {
+	t.Helper()
+
+	s := &pollServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.queries = append(s.queries, r.URL.Query())
+		s.mu.Unlock()
+
+		status, body := respond(r.URL.Query())
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(s.Close)
+
+	client := NewClient("token")
+	client.BaseURL = s.URL
+	client.RateLimiter = NewRateLimiter()
+
+	return s, client
+}
+
+func (s *pollServer) query(i int) url.Values {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.queries[i]
+}
+
+func TestPollStartsFromNowWithoutCheckpoint(t *testing.T) {
+	server, client := newPollServer(t, func(query url.Values) (int, string) {
+		return http.StatusOK, pollPage
+	})
+
+	before := time.Now()
+	p := client.newPoller(PollOptions{})
+
+	var received []string
+	callback := func(tweet TweetResponse) { received = append(received, tweet.Data.TweetID) }
+	if err := p.poll(context.Background(), searchRecentPath, url.Values{}, "key", "", callback); err != nil {
+		t.Fatal(err)
+	}
+
+	first := server.query(0)
+	if first.Has("since_id") {
+		t.Errorf("first poll sent since_id %s", first.Get("since_id"))
+	}
+	start, err := time.Parse(time.RFC3339, first.Get("start_time"))
+	if err != nil {
+		t.Fatalf("first poll start_time: %v", err)
+	}
+	if start.Before(before.Add(-11*time.Second)) || start.After(before) {
+		t.Errorf("first poll starts at %s, want about 10s before %s", start, before)
+	}
+
+	if !reflect.DeepEqual(received, []string{"2", "3"}) {
+		t.Errorf("received %v, want [2 3]", received)
+	}
+
+	if err := p.poll(context.Background(), searchRecentPath, url.Values{}, "key", "", callback); err != nil {
+		t.Fatal(err)
+	}
+	if second := server.query(1); second.Get("since_id") != "3" || second.Has("start_time") {
+		t.Errorf("second poll query %v, want since_id 3 and no start_time", second)
+	}
+}
+
+func TestPollRestartsFromNowOnInvalidSinceID(t *testing.T) {
+	server, client := newPollServer(t, func(query url.Values) (int, string) {
+		if query.Has("since_id") {
+			return http.StatusBadRequest, `{"errors":[{"parameters":{"since_id":["1"]},"message":"Invalid 'since_id':'1'. 'since_id' must be a tweet id created after 2023-01-01T00:00Z"}],"title":"Invalid Request"}`
+		}
+		return http.StatusOK, `{"meta":{"result_count":0}}`
+	})
+
+	checkpoints := &memoryCheckpoints{}
+	checkpoints.Store(context.Background(), "key", "1")
+	p := client.newPoller(PollOptions{Checkpoints: checkpoints})
+
+	if err := p.poll(context.Background(), searchRecentPath, url.Values{}, "key", "", func(tweet TweetResponse) {}); err != nil {
+		t.Fatalf("poll with a stale checkpoint returned %v", err)
+	}
+	if id, _ := checkpoints.Load(context.Background(), "key"); id != "" {
+		t.Errorf("checkpoint %q kept, want it dropped", id)
+	}
+
+	if err := p.poll(context.Background(), searchRecentPath, url.Values{}, "key", "", func(tweet TweetResponse) {}); err != nil {
+		t.Fatal(err)
+	}
+	if next := server.query(1); next.Has("since_id") || !next.Has("start_time") {
+		t.Errorf("poll after the reset query %v, want a start_time", next)
+	}
+}
+
+func TestPollSearchKeepsGoingAfterAFailingQuery(t *testing.T) {
+	_, client := newPollServer(t, func(query url.Values) (int, string) {
+		if query.Get("query") == "broken" {
+			return http.StatusInternalServerError, `{"title":"Internal Error"}`
+		}
+		return http.StatusOK, pollPage
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	received := make(chan string, 2)
+	queries := []SearchQuery{{Query: "broken"}, {Query: "works"}}
+	done := make(chan error, 1)
+	go func() {
+		done <- client.PollSearch(ctx, queries, DefaultStreamQueryParams(), PollOptions{}, func(tweet TweetResponse) {
+			received <- tweet.Data.TweetID
+		})
+	}()
+
+	select {
+	case <-received:
+	case err := <-done:
+		t.Fatalf("PollSearch returned %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the query after the failing one was not polled")
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("PollSearch returned %v, want context.Canceled", err)
+	}
+}
+
+func TestPollSearchRejectsSmallPages(t *testing.T) {
+	err := NewClient("token").PollSearch(context.Background(), []SearchQuery{{Query: "a"}}, DefaultStreamQueryParams(), PollOptions{MaxResults: 5}, func(tweet TweetResponse) {})
+	if err == nil {
+		t.Error("PollSearch accepted 5 max results")
+	}
+}
@@ -0,0 +1,135 @@
+package twitter
+
+import (
+	"context"
+	"expvar"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimitBudgets exposes the last known budget of every endpoint
+var rateLimitBudgets = expvar.NewMap("twitter_rate_limits")
+
+// DefaultRateLimiter is shared by the clients without a RateLimiter, the
+// limits of an app apply across all of its clients
+var DefaultRateLimiter = NewRateLimiter()
+
+// RateLimit is the state of the rate limit window of an endpoint, read from
+// the x-rate-limit-* response headers. It is zero when they are absent.
+type RateLimit struct {
+	Limit     int       `json:"limit"`
+	Remaining int       `json:"remaining"`
+	Reset     time.Time `json:"reset"`
+}
+
+func parseRateLimit(header http.Header) (RateLimit, bool) {
+	var rateLimit RateLimit
+	var err error
+	if rateLimit.Limit, err = strconv.Atoi(header.Get("x-rate-limit-limit")); err != nil {
+		return RateLimit{}, false
+	}
+	if rateLimit.Remaining, err = strconv.Atoi(header.Get("x-rate-limit-remaining")); err != nil {
+		return RateLimit{}, false
+	}
+	reset, err := strconv.ParseInt(header.Get("x-rate-limit-reset"), 10, 64)
+	if err != nil {
+		return RateLimit{}, false
+	}
+	rateLimit.Reset = time.Unix(reset, 0)
+
+	return rateLimit, true
+}
+
+// Exhausted reports whether no request is left before the window resets
+func (r RateLimit) Exhausted() bool {
+	return r.Remaining <= 0 && time.Now().Before(r.Reset)
+}
+
+// RateLimiter tracks the rate limit windows of the endpoints from the
+// response headers and holds requests back once a window is used up, rather
+// than getting locked out by the API for the rest of the window
+type RateLimiter struct {
+	mu     sync.Mutex
+	limits map[string]*RateLimit
+}
+
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{
+		limits: make(map[string]*RateLimit),
+	}
+}
+
+// Record updates the window of endpoint from the response headers, responses
+// without them are ignored
+func (l *RateLimiter) Record(endpoint string, header http.Header) {
+	rateLimit, ok := parseRateLimit(header)
+	if !ok {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, known := l.limits[endpoint]; !known {
+		rateLimitBudgets.Set(endpoint, expvar.Func(func() interface{} {
+			budget, _ := l.Budget(endpoint)
+			return budget
+		}))
+	}
+	l.limits[endpoint] = &rateLimit
+}
+
+// Budget returns the last known window of endpoint
+func (l *RateLimiter) Budget(endpoint string) (RateLimit, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rateLimit, ok := l.limits[endpoint]
+	if !ok {
+		return RateLimit{}, false
+	}
+
+	return *rateLimit, true
+}
+
+// Wait blocks until a request to endpoint is allowed and takes it from the
+// window, it returns ctx.Err() if ctx is cancelled first. Endpoints never
+// seen are not limited.
+func (l *RateLimiter) Wait(ctx context.Context, endpoint string) error {
+	for {
+		l.mu.Lock()
+		rateLimit, ok := l.limits[endpoint]
+		if !ok || !time.Now().Before(rateLimit.Reset) {
+			// the window is over, the next response tells the new one
+			l.mu.Unlock()
+			return nil
+		}
+		if rateLimit.Remaining > 0 {
+			rateLimit.Remaining--
+			l.mu.Unlock()
+			return nil
+		}
+		wait := time.Until(rateLimit.Reset) + time.Second
+		l.mu.Unlock()
+
+		if err := sleepContext(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// rateLimitEndpoint names the rate limit window of a request, IDs in the
+// path share the window of their endpoint
+func rateLimitEndpoint(req *http.Request) string {
+	segments := strings.Split(req.URL.Path, "/")
+	for i, segment := range segments {
+		if _, err := strconv.ParseUint(segment, 10, 64); err == nil && i > 1 {
+			segments[i] = ":id"
+		}
+	}
+
+	return req.Method + " " + strings.Join(segments, "/")
+}
@@ -0,0 +1,103 @@
+package twitter
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func rateLimitHeader(limit int, remaining int, reset time.Time) http.Header {
+	header := make(http.Header)
+	header.Set("x-rate-limit-limit", strconv.Itoa(limit))
+	header.Set("x-rate-limit-remaining", strconv.Itoa(remaining))
+	header.Set("x-rate-limit-reset", strconv.FormatInt(reset.Unix(), 10))
+
+	return header
+}
+
+func TestRateLimiterRecord(t *testing.T) {
+	l := NewRateLimiter()
+	reset := time.Now().Add(15 * time.Minute).Truncate(time.Second)
+
+	l.Record("GET /2/tweets/search/recent", rateLimitHeader(450, 449, reset))
+	l.Record("GET /2/tweets/search/recent", http.Header{"X-Rate-Limit-Limit": {"450"}})
+	l.Record("GET /2/users/by", http.Header{})
+
+	budget, ok := l.Budget("GET /2/tweets/search/recent")
+	if want := (RateLimit{Limit: 450, Remaining: 449, Reset: reset}); !ok || budget != want {
+		t.Errorf("budget %+v, want %+v kept over a response without the headers", budget, want)
+	}
+	if _, ok := l.Budget("GET /2/users/by"); ok {
+		t.Error("a response without the headers recorded a budget")
+	}
+}
+
+func TestRateLimiterCountsDownRemaining(t *testing.T) {
+	l := NewRateLimiter()
+	endpoint := "GET /2/tweets/search/recent"
+	l.Record(endpoint, rateLimitHeader(450, 2, time.Now().Add(15*time.Minute)))
+
+	for i := 0; i < 2; i++ {
+		if err := l.Wait(context.Background(), endpoint); err != nil {
+			t.Fatalf("request %d held back with requests left: %v", i+1, err)
+		}
+	}
+
+	if budget, _ := l.Budget(endpoint); budget.Remaining != 0 || !budget.Exhausted() {
+		t.Errorf("budget %+v, want it exhausted after 2 requests", budget)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx, endpoint); err != context.DeadlineExceeded {
+		t.Errorf("Wait on an exhausted window returned %v, want it to block until the deadline", err)
+	}
+}
+
+func TestRateLimiterWaitsForReset(t *testing.T) {
+	l := NewRateLimiter()
+	endpoint := "GET /2/tweets/search/recent"
+	l.limits[endpoint] = &RateLimit{Limit: 450, Remaining: 0, Reset: time.Now().Add(100 * time.Millisecond)}
+
+	start := time.Now()
+	if err := l.Wait(context.Background(), endpoint); err != nil {
+		t.Fatal(err)
+	}
+
+	// the reset is waited for with a second of margin
+	if waited := time.Since(start); waited < time.Second {
+		t.Errorf("Wait returned after %s, want after the reset and the margin", waited)
+	}
+}
+
+func TestRateLimiterUnknownEndpoint(t *testing.T) {
+	l := NewRateLimiter()
+	l.Record("GET /2/tweets/search/recent", rateLimitHeader(450, 0, time.Now().Add(15*time.Minute)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx, "GET /2/users/by"); err != nil {
+		t.Errorf("Wait on an endpoint never seen returned %v, want no limit", err)
+	}
+}
+
+func TestRateLimitEndpoint(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{method: http.MethodGet, path: "/2/tweets/search/stream", want: "GET /2/tweets/search/stream"},
+		{method: http.MethodGet, path: "/2/users/12/tweets", want: "GET /2/users/:id/tweets"},
+		{method: http.MethodPost, path: "/2/tweets/search/stream/rules", want: "POST /2/tweets/search/stream/rules"},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, "https://api.twitter.com"+tt.path+"?max_results=10", nil)
+		if got := rateLimitEndpoint(req); got != tt.want {
+			t.Errorf("rateLimitEndpoint(%s %s) = %q, want %q", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
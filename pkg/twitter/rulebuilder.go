@@ -0,0 +1,220 @@
+package twitter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/its-rav/makima/pkg/config"
+)
+
+// limits of the Essential access tier
+const (
+	DefaultMaxRuleLength = 512
+	DefaultMaxRules      = 5
+)
+
+const ruleOperatorOr = " OR "
+
+// RuleLimits are the per-rule length and rule count limits of the access tier
+type RuleLimits struct {
+	MaxLength int
+	MaxRules  int
+}
+
+func (l RuleLimits) maxLength() int {
+	if l.MaxLength <= 0 {
+		return DefaultMaxRuleLength
+	}
+
+	return l.MaxLength
+}
+
+func (l RuleLimits) maxRules() int {
+	if l.MaxRules <= 0 {
+		return DefaultMaxRules
+	}
+
+	return l.MaxRules
+}
+
+// RuleQuotaError is returned when the rules do not fit in the access tier
+type RuleQuotaError struct {
+	Needed int
+	Limit  int
+}
+
+func (e *RuleQuotaError) Error() string {
+	return fmt.Sprintf("twitter: %d rules needed but the rule quota is %d", e.Needed, e.Limit)
+}
+
+// FromHandles turns account handles into from: operators, a leading @ is
+// dropped and terms already using from: are kept as is
+func FromHandles(handles []string) []string {
+	var terms []string
+	for _, handle := range handles {
+		handle = strings.TrimSpace(handle)
+		if handle == "" {
+			continue
+		}
+		if strings.HasPrefix(handle, "from:") {
+			terms = append(terms, handle)
+			continue
+		}
+		terms = append(terms, "from:"+strings.TrimPrefix(handle, "@"))
+	}
+
+	return terms
+}
+
+// BuildStreamRules packs terms joined with OR into as few rules as possible
+// under limits.MaxLength, counted in characters. Every rule is tagged with
+// tag, so that tweets are routed by tag however many rules the terms are
+// packed into.
+//
+// The packing of the active rules with tag is kept: removed terms are taken
+// out of their rule and new terms go to the first rule with room left, so
+// that a change of the terms only touches the rules it has to. Without active
+// rules terms are packed in alphabetical order.
+//
+// A *RuleQuotaError is returned along with the rules when they exceed
+// limits.MaxRules.
+func BuildStreamRules(terms []string, tag string, limits RuleLimits, active []StreamRule) ([]AddStreamRule, error) {
+	rules, err := packStreamRules(terms, tag, limits.maxLength(), active)
+	if err != nil {
+		return nil, err
+	}
+
+	return rules, CheckRuleQuota(rules, limits)
+}
+
+func packStreamRules(terms []string, tag string, maxLength int, active []StreamRule) ([]AddStreamRule, error) {
+	wanted := make(map[string]bool)
+	var unique []string
+	for _, term := range terms {
+		term = strings.TrimSpace(term)
+		if term == "" || wanted[term] {
+			continue
+		}
+		if utf8.RuneCountInString(term) > maxLength {
+			return nil, fmt.Errorf("twitter: rule term %q is longer than %d characters", term, maxLength)
+		}
+		wanted[term] = true
+		unique = append(unique, term)
+	}
+	sort.Strings(unique)
+
+	// the active rules of tag, in a stable order, keep the terms still wanted
+	var existing []StreamRule
+	for _, rule := range active {
+		if rule.Tag == tag {
+			existing = append(existing, rule)
+		}
+	}
+	sort.Slice(existing, func(i, j int) bool { return existing[i].Value < existing[j].Value })
+
+	var bins [][]string
+	var lengths []int
+	placed := make(map[string]bool)
+	for _, rule := range existing {
+		var bin []string
+		length := 0
+		for _, term := range strings.Split(rule.Value, ruleOperatorOr) {
+			if !wanted[term] || placed[term] {
+				continue
+			}
+			next := length + utf8.RuneCountInString(term)
+			if len(bin) > 0 {
+				next += len(ruleOperatorOr)
+			}
+			if next > maxLength {
+				break
+			}
+			placed[term] = true
+			bin = append(bin, term)
+			length = next
+		}
+
+		if len(bin) > 0 {
+			bins = append(bins, bin)
+			lengths = append(lengths, length)
+		}
+	}
+
+	// first fit of the new terms
+	for _, term := range unique {
+		if placed[term] {
+			continue
+		}
+
+		termLength := utf8.RuneCountInString(term)
+		fits := false
+		for i := range bins {
+			if lengths[i]+len(ruleOperatorOr)+termLength <= maxLength {
+				bins[i] = append(bins[i], term)
+				lengths[i] += len(ruleOperatorOr) + termLength
+				fits = true
+				break
+			}
+		}
+
+		if !fits {
+			bins = append(bins, []string{term})
+			lengths = append(lengths, termLength)
+		}
+	}
+
+	var rules []AddStreamRule
+	for _, bin := range bins {
+		sort.Strings(bin)
+
+		rules = append(rules, AddStreamRule{
+			Value: strings.Join(bin, ruleOperatorOr),
+			Tag:   tag,
+		})
+	}
+
+	return rules, nil
+}
+
+// CheckRuleQuota returns a *RuleQuotaError when rules exceed limits.MaxRules
+func CheckRuleQuota(rules []AddStreamRule, limits RuleLimits) error {
+	if len(rules) > limits.maxRules() {
+		return &RuleQuotaError{
+			Needed: len(rules),
+			Limit:  limits.maxRules(),
+		}
+	}
+
+	return nil
+}
+
+// BuildStreamRulesFromConfig turns declared rules into stream rules, rules
+// listing accounts in From are packed with BuildStreamRules along the active
+// rules, all of them tagged with Tag
+func BuildStreamRulesFromConfig(ruleConfigs []config.StreamRuleConfig, limits RuleLimits, active []StreamRule) ([]AddStreamRule, error) {
+	var rules []AddStreamRule
+	for _, ruleConfig := range ruleConfigs {
+		if ruleConfig.Value != "" {
+			if utf8.RuneCountInString(ruleConfig.Value) > limits.maxLength() {
+				return nil, fmt.Errorf("twitter: rule %q is longer than %d characters", ruleConfig.Value, limits.maxLength())
+			}
+			rules = append(rules, AddStreamRule{
+				Value: ruleConfig.Value,
+				Tag:   ruleConfig.Tag,
+			})
+		}
+
+		if len(ruleConfig.From) > 0 {
+			// the quota is checked once all rules are built
+			built, err := packStreamRules(FromHandles(ruleConfig.From), ruleConfig.Tag, limits.maxLength(), active)
+			if err != nil {
+				return nil, err
+			}
+			rules = append(rules, built...)
+		}
+	}
+
+	return rules, CheckRuleQuota(rules, limits)
+}
@@ -0,0 +1,160 @@
+package twitter
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/its-rav/makima/pkg/config"
+)
+
+func TestFromHandles(t *testing.T) {
+	got := FromHandles([]string{"@alice", " bob ", "", "from:carol", "from:dave OR from:erin"})
+	want := []string{"from:alice", "from:bob", "from:carol", "from:dave OR from:erin"}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FromHandles returned %q, want %q", got, want)
+	}
+}
+
+// handles returns n handles of 8 characters
+func handles(n int) []string {
+	var terms []string
+	for i := 0; i < n; i++ {
+		terms = append(terms, fmt.Sprintf("from:%03d", i))
+	}
+
+	return terms
+}
+
+// activate gives rules ids as if they had been added to the stream
+func activate(rules []AddStreamRule) []StreamRule {
+	var active []StreamRule
+	for i, rule := range rules {
+		active = append(active, StreamRule{ID: strconv.Itoa(i + 1), Value: rule.Value, Tag: rule.Tag})
+	}
+
+	return active
+}
+
+func TestPackStreamRules(t *testing.T) {
+	// 8 characters per term and 4 per OR, 5 terms fit in 56 characters
+	rules, err := packStreamRules(append(handles(12), "from:003", " "), "news", 56, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"from:000 OR from:001 OR from:002 OR from:003 OR from:004",
+		"from:005 OR from:006 OR from:007 OR from:008 OR from:009",
+		"from:010 OR from:011",
+	}
+	if len(rules) != len(want) {
+		t.Fatalf("%d rules, want %d: %v", len(rules), len(want), rules)
+	}
+	for i, rule := range rules {
+		if rule.Value != want[i] || rule.Tag != "news" {
+			t.Errorf("rule %d is %+v, want %q tagged news", i, rule, want[i])
+		}
+	}
+}
+
+func TestPackStreamRulesCountsCharacters(t *testing.T) {
+	terms := []string{"from:ééééé", "from:ààààà"}
+
+	rules, err := packStreamRules(terms, "", 24, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 1 || utf8.RuneCountInString(rules[0].Value) != 24 {
+		t.Errorf("packed %q, want both terms in one rule of 24 characters", rules)
+	}
+
+	if _, err := packStreamRules([]string{"from:éééééééééé"}, "", 10, nil); err == nil {
+		t.Error("a term longer than the limit was accepted")
+	}
+}
+
+func TestPackStreamRulesKeepsActivePacking(t *testing.T) {
+	terms := handles(30)
+	rules, err := packStreamRules(terms, "news", 56, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	active := activate(rules)
+
+	tests := []struct {
+		name    string
+		terms   []string
+		add     int
+		deleted int
+	}{
+		// sorts before every other term, it would move them all alphabetically
+		{name: "added to a full rule", terms: append([]string{"from:00"}, terms...), add: 1},
+		{name: "removed", terms: append(append([]string{}, terms[:3]...), terms[4:]...), add: 1, deleted: 1},
+		{name: "added after a removal", terms: append(append([]string{"from:00"}, terms[:3]...), terms[4:]...), add: 1, deleted: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repacked, err := packStreamRules(tt.terms, "news", 56, active)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			plan := PlanStreamRules(active, repacked)
+			if len(plan.Add) != tt.add || len(plan.Delete) != tt.deleted {
+				t.Errorf("plan adds %d and deletes %d rules, want %d and %d:\n%s", len(plan.Add), len(plan.Delete), tt.add, tt.deleted, plan)
+			}
+		})
+	}
+}
+
+func TestPackStreamRulesIgnoresOtherTags(t *testing.T) {
+	active := []StreamRule{{ID: "1", Value: "from:b OR from:a", Tag: "other"}}
+
+	rules, err := packStreamRules([]string{"from:b", "from:a"}, "news", 56, active)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []AddStreamRule{{Value: "from:a OR from:b", Tag: "news"}}
+	if !reflect.DeepEqual(rules, want) {
+		t.Errorf("packed %+v, want %+v", rules, want)
+	}
+}
+
+func TestBuildStreamRulesFromConfig(t *testing.T) {
+	ruleConfigs := []config.StreamRuleConfig{
+		{Value: "#golang -is:retweet", Tag: "go"},
+		{From: []string{"@b", "a"}, Tag: "people"},
+	}
+
+	rules, err := BuildStreamRulesFromConfig(ruleConfigs, RuleLimits{MaxLength: 56, MaxRules: 2}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []AddStreamRule{
+		{Value: "#golang -is:retweet", Tag: "go"},
+		{Value: "from:a OR from:b", Tag: "people"},
+	}
+	if !reflect.DeepEqual(rules, want) {
+		t.Errorf("built %+v, want %+v", rules, want)
+	}
+
+	_, err = BuildStreamRulesFromConfig(ruleConfigs, RuleLimits{MaxLength: 56, MaxRules: 1}, nil)
+	var quotaErr *RuleQuotaError
+	if !errors.As(err, &quotaErr) || quotaErr.Needed != 2 || quotaErr.Limit != 1 {
+		t.Errorf("over the quota returned %v, want a RuleQuotaError for 2 rules out of 1", err)
+	}
+
+	_, err = BuildStreamRulesFromConfig([]config.StreamRuleConfig{{Value: strings.Repeat("a", 57)}}, RuleLimits{MaxLength: 56}, nil)
+	if err == nil {
+		t.Error("a rule longer than the limit was accepted")
+	}
+}
@@ -0,0 +1,170 @@
+package twitter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/its-rav/makima/pkg/config"
+)
+
+// StreamRulesPlan is the set of changes needed to turn the active stream
+// rules into the desired ones
+type StreamRulesPlan struct {
+	Add    []AddStreamRule `json:"add"`
+	Delete []StreamRule    `json:"delete"`
+	Keep   []StreamRule    `json:"keep"`
+}
+
+// Empty reports whether the active rules already match the desired ones
+func (p StreamRulesPlan) Empty() bool {
+	return len(p.Add) == 0 && len(p.Delete) == 0
+}
+
+func (p StreamRulesPlan) String() string {
+	var lines []string
+	for _, rule := range p.Keep {
+		lines = append(lines, fmt.Sprintf("  %s %s", ruleTagLabel(rule.Tag), rule.Value))
+	}
+	for _, rule := range p.Delete {
+		lines = append(lines, fmt.Sprintf("- %s %s", ruleTagLabel(rule.Tag), rule.Value))
+	}
+	for _, rule := range p.Add {
+		lines = append(lines, fmt.Sprintf("+ %s %s", ruleTagLabel(rule.Tag), rule.Value))
+	}
+
+	lines = append(lines, fmt.Sprintf("%d to add, %d to delete, %d unchanged", len(p.Add), len(p.Delete), len(p.Keep)))
+
+	return strings.Join(lines, "\n")
+}
+
+func ruleTagLabel(tag string) string {
+	if tag == "" {
+		return "[-]"
+	}
+
+	return fmt.Sprintf("[%s]", tag)
+}
+
+// ruleKey identifies a rule by its value and tag, a rule whose tag changed
+// has to be deleted and added again
+func ruleKey(value string, tag string) string {
+	return value + "\x00" + tag
+}
+
+// PlanStreamRules diffs the active rules against the desired ones
+func PlanStreamRules(active []StreamRule, desired []AddStreamRule) StreamRulesPlan {
+	var plan StreamRulesPlan
+
+	wanted := make(map[string]bool)
+	for _, rule := range desired {
+		wanted[ruleKey(rule.Value, rule.Tag)] = true
+	}
+
+	existing := make(map[string]bool)
+	for _, rule := range active {
+		key := ruleKey(rule.Value, rule.Tag)
+		if wanted[key] && !existing[key] {
+			plan.Keep = append(plan.Keep, rule)
+		} else {
+			plan.Delete = append(plan.Delete, rule)
+		}
+		existing[key] = true
+	}
+
+	for _, rule := range desired {
+		key := ruleKey(rule.Value, rule.Tag)
+		if existing[key] {
+			continue
+		}
+		plan.Add = append(plan.Add, rule)
+		existing[key] = true
+	}
+
+	return plan
+}
+
+// ReconcileStreamRules fetches the active stream rules, builds the declared
+// ones keeping the packing of the active rules, and only deletes and adds the
+// difference. With dryRun the plan is computed but nothing is changed.
+//
+// The new rules are validated before anything is changed, and added before
+// the old ones are deleted when limits.MaxRules leaves room for both, so
+// that a rejected rule does not leave the stream without rules.
+func (c *Client) ReconcileStreamRules(ruleConfigs []config.StreamRuleConfig, limits RuleLimits, dryRun bool) (StreamRulesPlan, error) {
+	active, err := c.GetStreamRules()
+	if err != nil {
+		return StreamRulesPlan{}, err
+	}
+
+	desired, err := BuildStreamRulesFromConfig(ruleConfigs, limits, active.Data)
+	if err != nil {
+		return StreamRulesPlan{}, err
+	}
+
+	plan := PlanStreamRules(active.Data, desired)
+	if dryRun || plan.Empty() {
+		return plan, nil
+	}
+
+	// a rule whose tag changed keeps its value, the API refuses a duplicate
+	// value so the old rule has to be deleted first
+	adding := make(map[string]bool)
+	for _, rule := range plan.Add {
+		adding[rule.Value] = true
+	}
+	deleting := make(map[string]bool)
+	for _, rule := range plan.Delete {
+		deleting[rule.Value] = true
+	}
+
+	var validate []AddStreamRule
+	for _, rule := range plan.Add {
+		if !deleting[rule.Value] {
+			validate = append(validate, rule)
+		}
+	}
+	if len(validate) > 0 {
+		if _, err := c.ValidateStreamRules(validate); err != nil {
+			return plan, err
+		}
+	}
+
+	var first, last []StreamRule
+	for _, rule := range plan.Delete {
+		if adding[rule.Value] {
+			first = append(first, rule)
+		} else {
+			last = append(last, rule)
+		}
+	}
+	if len(active.Data)-len(first)+len(plan.Add) > limits.maxRules() {
+		first, last = plan.Delete, nil
+	}
+
+	if err := c.deleteRules(first); err != nil {
+		return plan, err
+	}
+
+	if len(plan.Add) > 0 {
+		if _, err := c.AddStreamRules(plan.Add); err != nil {
+			return plan, err
+		}
+	}
+
+	return plan, c.deleteRules(last)
+}
+
+func (c *Client) deleteRules(rules []StreamRule) error {
+	if len(rules) == 0 {
+		return nil
+	}
+
+	var ids []string
+	for _, rule := range rules {
+		ids = append(ids, rule.ID)
+	}
+
+	_, err := c.DeleteStreamRules(ids)
+
+	return err
+}
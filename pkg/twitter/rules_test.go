@@ -0,0 +1,178 @@
+package twitter_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/its-rav/makima/pkg/config"
+	"github.com/its-rav/makima/pkg/twitter"
+	"github.com/its-rav/makima/pkg/twitter/twittertest"
+)
+
+// rulesServer is a fake server recording the changes made to the rules, in
+// order: "add", "validate" or "delete"
+type rulesServer struct {
+	*twittertest.Server
+	client *twitter.Client
+
+	mu      sync.Mutex
+	changes []string
+}
+
+func newRulesServer(t *testing.T, opts twittertest.Options, active ...twitter.AddStreamRule) *rulesServer {
+	t.Helper()
+
+	s := &rulesServer{Server: twittertest.New(opts)}
+	handler := s.Handler()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			body, _ := io.ReadAll(r.Body)
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			change := "add"
+			switch {
+			case strings.Contains(string(body), `"delete"`):
+				change = "delete"
+			case r.URL.Query().Get("dry_run") == "true":
+				change = "validate"
+			}
+			s.mu.Lock()
+			s.changes = append(s.changes, change)
+			s.mu.Unlock()
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	s.client = twitter.NewClient(twittertest.DefaultBearerToken)
+	s.client.BaseURL = server.URL
+	s.client.RateLimiter = twitter.NewRateLimiter()
+
+	if len(active) > 0 {
+		if _, err := s.client.AddStreamRules(active); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.changes = nil
+
+	return s
+}
+
+func (s *rulesServer) values() []string {
+	var values []string
+	for _, rule := range s.Rules() {
+		values = append(values, rule.Tag+" "+rule.Value)
+	}
+
+	return values
+}
+
+func TestReconcileStreamRulesAddsBeforeDeleting(t *testing.T) {
+	server := newRulesServer(t, twittertest.Options{}, twitter.AddStreamRule{Value: "from:a", Tag: "people"})
+
+	plan, err := server.client.ReconcileStreamRules([]config.StreamRuleConfig{{From: []string{"b"}, Tag: "people"}}, twitter.RuleLimits{MaxRules: 2}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Add) != 1 || len(plan.Delete) != 1 {
+		t.Fatalf("plan\n%s\nwant one rule added and one deleted", plan)
+	}
+
+	if want := []string{"validate", "add", "delete"}; !reflect.DeepEqual(server.changes, want) {
+		t.Errorf("changes %v, want %v", server.changes, want)
+	}
+	if want := []string{"people from:b"}; !reflect.DeepEqual(server.values(), want) {
+		t.Errorf("rules %v, want %v", server.values(), want)
+	}
+}
+
+func TestReconcileStreamRulesDeletesFirstAtTheQuota(t *testing.T) {
+	server := newRulesServer(t, twittertest.Options{}, twitter.AddStreamRule{Value: "from:a", Tag: "people"})
+
+	_, err := server.client.ReconcileStreamRules([]config.StreamRuleConfig{{From: []string{"b"}, Tag: "people"}}, twitter.RuleLimits{MaxRules: 1}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"validate", "delete", "add"}; !reflect.DeepEqual(server.changes, want) {
+		t.Errorf("changes %v, want %v", server.changes, want)
+	}
+}
+
+func TestReconcileStreamRulesRetagsRules(t *testing.T) {
+	server := newRulesServer(t, twittertest.Options{}, twitter.AddStreamRule{Value: "from:a", Tag: "people"})
+
+	_, err := server.client.ReconcileStreamRules([]config.StreamRuleConfig{{Value: "from:a", Tag: "news"}}, twitter.RuleLimits{}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"news from:a"}; !reflect.DeepEqual(server.values(), want) {
+		t.Errorf("rules %v, want %v", server.values(), want)
+	}
+}
+
+func TestReconcileStreamRulesKeepsRulesWhenRejected(t *testing.T) {
+	server := newRulesServer(t, twittertest.Options{MaxRuleLength: 12}, twitter.AddStreamRule{Value: "from:a", Tag: "people"})
+
+	_, err := server.client.ReconcileStreamRules([]config.StreamRuleConfig{{From: []string{"b", "c"}, Tag: "people"}}, twitter.RuleLimits{}, false)
+	if err == nil {
+		t.Fatal("a rule rejected by the API was accepted")
+	}
+
+	if want := []string{"validate"}; !reflect.DeepEqual(server.changes, want) {
+		t.Errorf("changes %v, want %v", server.changes, want)
+	}
+	if want := []string{"people from:a"}; !reflect.DeepEqual(server.values(), want) {
+		t.Errorf("rules %v, want %v", server.values(), want)
+	}
+}
+
+func TestReconcileStreamRulesDryRun(t *testing.T) {
+	server := newRulesServer(t, twittertest.Options{}, twitter.AddStreamRule{Value: "from:a", Tag: "people"})
+
+	plan, err := server.client.ReconcileStreamRules([]config.StreamRuleConfig{{From: []string{"b"}, Tag: "people"}}, twitter.RuleLimits{}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(plan.Add) != 1 || len(plan.Delete) != 1 || len(server.changes) != 0 {
+		t.Errorf("dry run planned\n%s\nand made changes %v", plan, server.changes)
+	}
+}
+
+func TestPlanStreamRules(t *testing.T) {
+	active := []twitter.StreamRule{
+		{ID: "1", Value: "from:a", Tag: "people"},
+		{ID: "2", Value: "from:b", Tag: "people"},
+		{ID: "3", Value: "from:c", Tag: "people"},
+		{ID: "4", Value: "from:c", Tag: "people"},
+	}
+	desired := []twitter.AddStreamRule{
+		{Value: "from:a", Tag: "people"},
+		{Value: "from:b", Tag: "news"},
+		{Value: "from:c", Tag: "people"},
+		{Value: "from:d", Tag: "people"},
+	}
+
+	plan := twitter.PlanStreamRules(active, desired)
+
+	want := twitter.StreamRulesPlan{
+		Add:    []twitter.AddStreamRule{{Value: "from:b", Tag: "news"}, {Value: "from:d", Tag: "people"}},
+		Delete: []twitter.StreamRule{active[1], active[3]},
+		Keep:   []twitter.StreamRule{active[0], active[2]},
+	}
+	if !reflect.DeepEqual(plan, want) {
+		t.Errorf("plan\n%s\nwant\n%s", plan, want)
+	}
+
+	if !twitter.PlanStreamRules(active[:1], desired[:1]).Empty() {
+		t.Error("plan of matching rules is not empty")
+	}
+}
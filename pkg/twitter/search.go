@@ -0,0 +1,91 @@
+package twitter
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+const (
+	searchRecentPath = "/2/tweets/search/recent"
+	// MinSearchMaxResults is the smallest page recent search accepts
+	MinSearchMaxResults = 10
+)
+
+// SearchQuery is a recent search query, Tag is given to the tweets it finds
+// like the tag of a stream rule
+type SearchQuery struct {
+	Query string `json:"query"`
+	Tag   string `json:"tag"`
+}
+
+// SearchQueriesFromRules turns stream rules into the equivalent searches,
+// the filtered stream and recent search share the same query syntax
+func SearchQueriesFromRules(rules []AddStreamRule) []SearchQuery {
+	var queries []SearchQuery
+	for _, rule := range rules {
+		queries = append(queries, SearchQuery{
+			Query: rule.Value,
+			Tag:   rule.Tag,
+		})
+	}
+
+	return queries
+}
+
+// checkpointKey identifies the query, queries can be longer than a sensible key
+func (q SearchQuery) checkpointKey() string {
+	sum := sha1.Sum([]byte(q.Query))
+	return "search:" + hex.EncodeToString(sum[:8])
+}
+
+// SearchRecent returns the most recent page of tweets matching query
+func (c *Client) SearchRecent(ctx context.Context, query string, params GetStreamQueryParams) (TweetsResponse, error) {
+	var page TweetsResponse
+	err := c.doJSONRequestContext(ctx, "GET", searchRecentPath+"?"+searchQueryParams(query, params).Encode(), nil, &page)
+
+	return page, err
+}
+
+// PollSearch polls recent search for each query every opts.Interval and
+// invokes callback for every new tweet, oldest first. It is a degraded
+// replacement for Stream: tweets arrive with up to an interval of delay.
+//
+// PollSearch returns ctx.Err() once ctx is cancelled, or an *HTTPError for
+// responses that retrying cannot fix (ErrUnauthorized, ErrForbidden).
+func (c *Client) PollSearch(ctx context.Context, queries []SearchQuery, params GetStreamQueryParams, opts PollOptions, callback func(tweet TweetResponse)) error {
+	if opts.MaxResults != 0 && opts.MaxResults < MinSearchMaxResults {
+		return fmt.Errorf("twitter: recent search returns at least %d results per page, max results is %d", MinSearchMaxResults, opts.MaxResults)
+	}
+
+	log := opts.logger()
+	poller := c.newPoller(opts)
+
+	log.Infof("[twitter] polling recent search for %d queries every %s", len(queries), opts.interval())
+
+	return pollLoop(ctx, opts, func(ctx context.Context) error {
+		for _, query := range queries {
+			err := poller.poll(ctx, searchRecentPath, searchQueryParams(query.Query, params), query.checkpointKey(), query.Tag, callback)
+			switch {
+			case errors.Is(err, ErrRateLimited), errors.Is(err, ErrUnauthorized), errors.Is(err, ErrForbidden), ctx.Err() != nil:
+				return err
+			case err != nil:
+				// one failing query does not hold back the others
+				log.Warnf("[twitter] failed to search %q: %v", query.Query, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// searchQueryParams selects the same fields as the stream for query
+func searchQueryParams(query string, params GetStreamQueryParams) url.Values {
+	values := pollQueryParams(params)
+	values.Set("query", query)
+
+	return values
+}
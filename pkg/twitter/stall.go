@@ -0,0 +1,74 @@
+package twitter
+
+import (
+	"expvar"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultStallTimeout is the silence window after which the stream is
+// considered dead, Twitter sends a keep-alive every ~20 seconds
+const DefaultStallTimeout = 30 * time.Second
+
+// streamStalls counts the connections dropped by the stall detector
+var streamStalls = expvar.NewInt("twitter_stream_stalls")
+
+// stallWatchdog calls abort when it has not been kicked for timeout, turning
+// a server that never answers or a half-open connection into an error
+type stallWatchdog struct {
+	timeout time.Duration
+	timer   *time.Timer
+	stalled int32
+}
+
+func newStallWatchdog(timeout time.Duration, abort func()) *stallWatchdog {
+	w := &stallWatchdog{
+		timeout: timeout,
+	}
+	w.timer = time.AfterFunc(timeout, func() {
+		atomic.StoreInt32(&w.stalled, 1)
+		abort()
+	})
+
+	return w
+}
+
+func (w *stallWatchdog) kick() {
+	w.timer.Reset(w.timeout)
+}
+
+func (w *stallWatchdog) stop() {
+	w.timer.Stop()
+}
+
+func (w *stallWatchdog) isStalled() bool {
+	return atomic.LoadInt32(&w.stalled) == 1
+}
+
+// wrap returns a reader kicking the watchdog on every read and reporting
+// ErrStreamStalled once it fired
+func (w *stallWatchdog) wrap(body io.Reader) io.Reader {
+	return &stallReader{
+		body:     body,
+		watchdog: w,
+	}
+}
+
+type stallReader struct {
+	body     io.Reader
+	watchdog *stallWatchdog
+}
+
+func (r *stallReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	if n > 0 {
+		r.watchdog.kick()
+	}
+
+	if err != nil && r.watchdog.isStalled() {
+		return n, ErrStreamStalled
+	}
+
+	return n, err
+}
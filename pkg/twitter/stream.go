@@ -0,0 +1,273 @@
+package twitter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/its-rav/makima/pkg/logger"
+)
+
+// StreamOptions tunes the behaviour of Stream and StreamTweets
+type StreamOptions struct {
+	// Logger receives connection and reconnect events, discarded when nil
+	Logger logger.Logger
+	// StallTimeout is the silence window after which the connection is
+	// dropped and re-established, DefaultStallTimeout when zero
+	StallTimeout time.Duration
+	// Capture receives a copy of the raw stream bytes, see CaptureWriter
+	Capture io.Writer
+	// OnError receives the error objects sent on the stream, they are logged
+	// when nil. Operational disconnects and connection errors also end the
+	// connection, the stream then reconnects on its own.
+	OnError func(streamErr *StreamError)
+}
+
+func (o StreamOptions) logger() logger.Logger {
+	if o.Logger == nil {
+		return logger.NopLogger{}
+	}
+
+	return o.Logger
+}
+
+func (o StreamOptions) onError(streamErr *StreamError) {
+	if o.OnError == nil {
+		o.logger().Error(streamErr, "[twitter] stream error")
+		return
+	}
+
+	o.OnError(streamErr)
+}
+
+func (o StreamOptions) stallTimeout() time.Duration {
+	if o.StallTimeout <= 0 {
+		return DefaultStallTimeout
+	}
+
+	return o.StallTimeout
+}
+
+// Stream connects to the filtered stream and invokes callback for every tweet
+// received. It reconnects on disconnects, network errors and HTTP errors
+// following the documented backoff schedules.
+//
+// Stream returns ctx.Err() once ctx is cancelled, the request is bound to ctx
+// so cancelling it also closes the response body. An *HTTPError is returned
+// for responses that retrying cannot fix (ErrUnauthorized, ErrForbidden).
+func (c *Client) Stream(ctx context.Context, params GetStreamQueryParams, opts StreamOptions, callback func(tweet TweetResponse)) error {
+	log := opts.logger()
+	stallTimeout := opts.stallTimeout()
+
+	var queryParams string = convertStructToQueryParams(params)
+
+	// /2/tweets/search/stream is a stream endpoint
+	path := fmt.Sprintf("/2/tweets/search/stream?%s", queryParams)
+
+	log.Infof("[twitter] connecting to stream %s", c.url(path))
+
+	var b backoff
+	var tokenReset bool
+	for attempt := 1; ; attempt++ {
+		err := c.connectStream(ctx, path, opts, &b, callback)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if errors.Is(err, ErrStreamStalled) {
+			streamStalls.Add(1)
+			log.Warnf("[twitter] stream stalled, nothing received for %s", stallTimeout)
+		}
+
+		var wait time.Duration
+		var httpErr *HTTPError
+		var streamErr *StreamError
+		switch {
+		case errors.Is(err, ErrUnauthorized) && !tokenReset && c.resetToken(ctx):
+			// the token may have been revoked since it was cached, retry once
+			// with a fresh one
+			tokenReset = true
+		case errors.Is(err, ErrUnauthorized), errors.Is(err, ErrForbidden):
+			return err
+		case errors.Is(err, ErrRateLimited) && errors.As(err, &httpErr):
+			wait = b.rateLimit(httpErr.RateLimitReset)
+		case errors.As(err, &streamErr) && streamErr.TooManyConnections():
+			// another connection is still open, it takes a while to be released
+			wait = b.rateLimit(time.Time{})
+		case errors.As(err, &httpErr):
+			wait = b.http()
+		default:
+			wait = b.network()
+		}
+
+		log.Warnf("[twitter] stream disconnected: %v, reconnecting in %s (attempt %d)", err, wait, attempt)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// StreamTweets runs Stream in the background and delivers tweets through the
+// returned channel. The error channel receives the value returned by Stream,
+// after which both channels are closed.
+func (c *Client) StreamTweets(ctx context.Context, params GetStreamQueryParams, opts StreamOptions) (<-chan TweetResponse, <-chan error) {
+	tweets := make(chan TweetResponse)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(errs)
+		defer close(tweets)
+
+		errs <- c.Stream(ctx, params, opts, func(tweet TweetResponse) {
+			select {
+			case tweets <- tweet:
+			case <-ctx.Done():
+			}
+		})
+	}()
+
+	return tweets, errs
+}
+
+// OnStreamReceived streams tweets until an unrecoverable error occurs.
+//
+// Deprecated: use Stream, which can be cancelled and reports errors.
+func OnStreamReceived(log logger.Logger, bearerToken string, params GetStreamQueryParams, callback func(tweet TweetResponse)) {
+	err := NewClient(bearerToken).Stream(context.Background(), params, StreamOptions{Logger: log}, callback)
+	log.Error(err, "[twitter] stream stopped")
+}
+
+// connectStream performs a single connection to the stream and decodes tweets
+// until the connection is dropped, the returned error is never nil
+func (c *Client) connectStream(ctx context.Context, path string, opts StreamOptions, b *backoff, callback func(tweet TweetResponse)) error {
+	// the watchdog cancels the request when the server stays silent, whether
+	// it never answers or stops sending keep-alives
+	connCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	req, err := c.newRequest(connCtx, "GET", path, nil)
+	if err != nil {
+		return err
+	}
+
+	// a reconnect storm uses up the connection budget, wait for the window to
+	// reset rather than getting locked out, before the watchdog is started
+	endpoint := rateLimitEndpoint(req)
+	if budget, ok := c.rateLimiter().Budget(endpoint); ok && budget.Exhausted() {
+		opts.logger().Warnf("[twitter] stream connection limit of %d reached, waiting until %s", budget.Limit, budget.Reset.Format(time.RFC3339))
+	}
+	if err := c.rateLimiter().Wait(ctx, endpoint); err != nil {
+		return err
+	}
+
+	watchdog := newStallWatchdog(opts.stallTimeout(), cancel)
+	defer watchdog.stop()
+
+	resp, err := c.send(req, endpoint)
+	if err != nil {
+		if watchdog.isStalled() {
+			return ErrStreamStalled
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := ioutil.ReadAll(resp.Body)
+		return newHTTPError(resp, bodyBytes)
+	}
+
+	// connected, the next disconnect starts a fresh schedule
+	b.reset()
+	watchdog.kick()
+
+	// keep-alive newlines are skipped by the decoder but still kick the watchdog
+	body := watchdog.wrap(resp.Body)
+	if opts.Capture != nil {
+		tee := &captureTee{
+			w:   opts.Capture,
+			log: opts.logger(),
+		}
+		tee.markConnection()
+		body = io.TeeReader(body, tee)
+	}
+
+	return decodeStream(body, func(streamErr *StreamError) bool {
+		opts.onError(streamErr)
+		return streamErr.Disconnect() || streamErr.TooManyConnections()
+	}, callback)
+}
+
+// decodeStream decodes tweets from raw stream bytes until r fails, the
+// returned error is never nil. Error objects are passed to onError and end
+// decoding when it returns true.
+func decodeStream(r io.Reader, onError func(streamErr *StreamError) bool, callback func(tweet TweetResponse)) error {
+	dec := json.NewDecoder(r)
+	for {
+		var tweetResponse TweetResponse
+		err := dec.Decode(&tweetResponse)
+		if err == io.EOF {
+			return ErrStreamClosed
+		}
+		if err != nil {
+			return err
+		}
+
+		// errors sent instead of a tweet, a tweet may still carry partial
+		// errors about its expansions
+		if tweetResponse.Data.TweetID == "" {
+			if len(tweetResponse.Errors) == 0 {
+				continue
+			}
+
+			streamErr := &StreamError{Errors: tweetResponse.Errors}
+			if onError(streamErr) {
+				return streamErr
+			}
+			continue
+		}
+
+		callback(tweetResponse)
+	}
+}
+
+// captureTee never fails so that a full disk does not take the stream down,
+// the first error of a connection is logged
+type captureTee struct {
+	w      io.Writer
+	log    logger.Logger
+	failed bool
+}
+
+// markConnection separates the bytes of each connection when the capture
+// supports it, see CaptureWriter.MarkConnection
+func (t *captureTee) markConnection() {
+	marker, ok := t.w.(interface{ MarkConnection() error })
+	if !ok {
+		return
+	}
+
+	if err := marker.MarkConnection(); err != nil && !t.failed {
+		t.failed = true
+		t.log.Error(err, "[twitter] failed to capture stream bytes")
+	}
+}
+
+func (t *captureTee) Write(p []byte) (int, error) {
+	if _, err := t.w.Write(p); err != nil && !t.failed {
+		t.failed = true
+		t.log.Error(err, "[twitter] failed to capture stream bytes")
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,64 @@
+package twitter
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecodeStreamRoutesErrors(t *testing.T) {
+	payloads := []string{
+		// sent instead of a tweet
+		`{"errors":[{"title":"operational-disconnect","disconnect_type":"UpstreamOperationalDisconnect","type":"https://api.twitter.com/2/problems/operational-disconnect"}]}`,
+		// a tweet whose quoted tweet could not be expanded
+		`{"data":{"id":"1","text":"tweet 1"},"errors":[{"title":"Not Found Error","resource_type":"tweet","resource_id":"2","type":"https://api.twitter.com/2/problems/resource-not-found"}]}`,
+		"",
+		`{"data":{"id":"3","text":"tweet 3"}}`,
+	}
+
+	var streamErrs []*StreamError
+	var tweets []TweetResponse
+	err := decodeStream(strings.NewReader(strings.Join(payloads, "\r\n")), func(streamErr *StreamError) bool {
+		streamErrs = append(streamErrs, streamErr)
+		return false
+	}, func(tweet TweetResponse) {
+		tweets = append(tweets, tweet)
+	})
+	if err != ErrStreamClosed {
+		t.Fatalf("decodeStream returned %v, want ErrStreamClosed", err)
+	}
+
+	if len(streamErrs) != 1 || !streamErrs[0].Disconnect() {
+		t.Errorf("onError received %v, want the operational disconnect only", streamErrs)
+	}
+
+	var ids []string
+	for _, tweet := range tweets {
+		ids = append(ids, tweet.Data.TweetID)
+	}
+	if !reflect.DeepEqual(ids, []string{"1", "3"}) {
+		t.Fatalf("callback received tweets %v, want [1 3]", ids)
+	}
+	if len(tweets[0].Errors) != 1 || tweets[0].Errors[0].ResourceID != "2" {
+		t.Errorf("tweet 1 carries errors %+v, want the partial error about tweet 2", tweets[0].Errors)
+	}
+}
+
+func TestDecodeStreamStopsOnFatalErrors(t *testing.T) {
+	payloads := `{"errors":[{"title":"ConnectionException","type":"https://api.twitter.com/2/problems/streaming-connection"}]}` + "\r\n" +
+		`{"data":{"id":"1","text":"tweet 1"}}`
+
+	called := false
+	err := decodeStream(strings.NewReader(payloads), func(streamErr *StreamError) bool {
+		return true
+	}, func(tweet TweetResponse) {
+		called = true
+	})
+
+	if _, ok := err.(*StreamError); !ok {
+		t.Errorf("decodeStream returned %v, want the StreamError", err)
+	}
+	if called {
+		t.Error("a tweet was decoded after the stream was stopped")
+	}
+}
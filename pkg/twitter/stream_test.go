@@ -0,0 +1,211 @@
+package twitter_test
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/its-rav/makima/pkg/twitter"
+	"github.com/its-rav/makima/pkg/twitter/twittertest"
+)
+
+const streamEndpoint = "GET /2/tweets/search/stream"
+
+// streamHarness runs Stream against a fake server until the test ends
+type streamHarness struct {
+	server *twittertest.Server
+	client *twitter.Client
+	tweets chan twitter.TweetResponse
+	done   chan error
+	cancel context.CancelFunc
+}
+
+func startStream(t *testing.T, server *twittertest.Server, opts twitter.StreamOptions) *streamHarness {
+	t.Helper()
+
+	client := server.Client()
+	client.RateLimiter = twitter.NewRateLimiter()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	h := &streamHarness{
+		server: server,
+		client: client,
+		tweets: make(chan twitter.TweetResponse, 16),
+		done:   make(chan error, 1),
+		cancel: cancel,
+	}
+
+	go func() {
+		h.done <- client.Stream(ctx, twitter.DefaultStreamQueryParams(), opts, func(tweet twitter.TweetResponse) {
+			h.tweets <- tweet
+		})
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+		select {
+		case err := <-h.done:
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("Stream returned %v, want context.Canceled", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Error("Stream did not return once cancelled")
+		}
+		server.Close()
+	})
+
+	return h
+}
+
+// receive sends tweet id on the open streams until it is received, the
+// stream may not be connected yet
+func (h *streamHarness) receive(t *testing.T, id string) twitter.TweetResponse {
+	t.Helper()
+
+	payload := []byte(fmt.Sprintf(`{"data":{"id":%q,"text":"tweet %s","author_id":"1"}}`, id, id))
+	timeout := time.After(10 * time.Second)
+	for {
+		h.server.Send(payload)
+
+		select {
+		case tweet := <-h.tweets:
+			// extra copies of the tweets received before
+			if tweet.Data.TweetID != id {
+				continue
+			}
+			return tweet
+		case err := <-h.done:
+			t.Fatalf("Stream returned %v", err)
+		case <-timeout:
+			t.Fatalf("tweet %s not received", id)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+}
+
+func waitConnections(t *testing.T, server *twittertest.Server, want int) {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for server.Connections() < want {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d stream connections, want %d", server.Connections(), want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStreamReconnectsAfterDisconnect(t *testing.T) {
+	defer twitter.SetBackoff(10 * time.Millisecond)()
+
+	h := startStream(t, twittertest.NewServer(twittertest.Options{}), twitter.StreamOptions{})
+
+	h.receive(t, "1")
+	h.server.Disconnect()
+	h.receive(t, "2")
+
+	if got := h.server.Connections(); got != 2 {
+		t.Errorf("%d stream connections, want 2", got)
+	}
+}
+
+func TestStreamWaitsForRateLimitReset(t *testing.T) {
+	defer twitter.SetBackoff(10 * time.Millisecond)()
+
+	server := twittertest.NewServer(twittertest.Options{})
+	server.FailStream(429, 1)
+	h := startStream(t, server, twitter.StreamOptions{})
+
+	waitConnections(t, server, 1)
+	h.receive(t, "1")
+	connected := time.Now()
+
+	budget, ok := h.client.RateLimiter.Budget(streamEndpoint)
+	if !ok {
+		t.Fatalf("no budget recorded for %s", streamEndpoint)
+	}
+	if connected.Before(budget.Reset) {
+		t.Errorf("reconnected at %s, before the rate limit reset at %s", connected, budget.Reset)
+	}
+	if got := server.Connections(); got != 2 {
+		t.Errorf("%d stream connections, want 2", got)
+	}
+}
+
+func TestStreamReconnectsWhenStalled(t *testing.T) {
+	defer twitter.SetBackoff(10 * time.Millisecond)()
+
+	stalls := expvar.Get("twitter_stream_stalls").(*expvar.Int)
+	before := stalls.Value()
+
+	server := twittertest.NewServer(twittertest.Options{KeepAlive: 20 * time.Millisecond})
+	h := startStream(t, server, twitter.StreamOptions{StallTimeout: 200 * time.Millisecond})
+
+	h.receive(t, "1")
+
+	// keep-alives hold the connection open past the stall timeout
+	time.Sleep(400 * time.Millisecond)
+	if got := server.Connections(); got != 1 {
+		t.Fatalf("%d stream connections with keep-alives, want 1", got)
+	}
+
+	server.PauseKeepAlive(true)
+	waitConnections(t, server, 2)
+	server.PauseKeepAlive(false)
+
+	if got := stalls.Value() - before; got < 1 {
+		t.Errorf("twitter_stream_stalls increased by %d, want at least 1", got)
+	}
+	h.receive(t, "2")
+}
+
+func TestStreamReconnectsAfterMalformedPayload(t *testing.T) {
+	defer twitter.SetBackoff(10 * time.Millisecond)()
+
+	h := startStream(t, twittertest.NewServer(twittertest.Options{}), twitter.StreamOptions{})
+
+	h.receive(t, "1")
+	h.server.SendMalformed()
+	waitConnections(t, h.server, 2)
+
+	tweet := h.receive(t, "2")
+	if tweet.Data.Content != "tweet 2" {
+		t.Errorf("received %q, want %q", tweet.Data.Content, "tweet 2")
+	}
+}
+
+func TestStreamCaptureReplaysEveryConnection(t *testing.T) {
+	defer twitter.SetBackoff(10 * time.Millisecond)()
+
+	path := filepath.Join(t.TempDir(), "capture.jsonl")
+	capture, err := twitter.NewCaptureWriter(path, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := startStream(t, twittertest.NewServer(twittertest.Options{}), twitter.StreamOptions{Capture: capture})
+
+	h.receive(t, "1")
+	h.server.SendMalformed()
+	waitConnections(t, h.server, 2)
+	h.receive(t, "2")
+	h.cancel()
+	// the stream may still be writing to the capture until it returns
+	h.done <- <-h.done
+	capture.Close()
+
+	seen := make(map[string]bool)
+	err = twitter.Replay(context.Background(), []string{path}, 0, twitter.StreamOptions{}, func(tweet twitter.TweetResponse) {
+		seen[tweet.Data.TweetID] = true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !seen["1"] || !seen["2"] {
+		t.Errorf("replayed tweets %v, want 1 and 2 on both sides of the malformed payload", seen)
+	}
+}
@@ -0,0 +1,132 @@
+package twitter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	usersByPath = "/2/users/by"
+	// MaxUsernamesPerLookup is the number of usernames /2/users/by resolves at once
+	MaxUsernamesPerLookup = 100
+)
+
+// UsersResponse is returned by the user lookup endpoints, unknown and
+// suspended accounts are reported in Errors
+type UsersResponse struct {
+	Data   []User     `json:"data"`
+	Errors []APIError `json:"errors,omitempty"`
+}
+
+// TimelineUser is an account followed by PollTimelines, Tag is given to its
+// tweets like the tag of a stream rule
+type TimelineUser struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Tag      string `json:"tag"`
+}
+
+// GetUsersByUsernames resolves usernames to users, a leading @ is ignored
+func (c *Client) GetUsersByUsernames(ctx context.Context, usernames []string) (UsersResponse, error) {
+	var users UsersResponse
+	for start := 0; start < len(usernames); start += MaxUsernamesPerLookup {
+		end := start + MaxUsernamesPerLookup
+		if end > len(usernames) {
+			end = len(usernames)
+		}
+
+		var batch []string
+		for _, username := range usernames[start:end] {
+			batch = append(batch, strings.TrimPrefix(username, "@"))
+		}
+
+		query := url.Values{}
+		query.Set("usernames", strings.Join(batch, ","))
+
+		var page UsersResponse
+		if err := c.doJSONRequestContext(ctx, "GET", usersByPath+"?"+query.Encode(), nil, &page); err != nil {
+			return users, err
+		}
+
+		users.Data = append(users.Data, page.Data...)
+		users.Errors = append(users.Errors, page.Errors...)
+	}
+
+	return users, nil
+}
+
+// ResolveTimelineUsers fills in the ID of the users, accounts that cannot be
+// resolved are returned in an error along with the ones that could
+func (c *Client) ResolveTimelineUsers(ctx context.Context, users []TimelineUser) ([]TimelineUser, error) {
+	var usernames []string
+	for _, user := range users {
+		if user.ID == "" {
+			usernames = append(usernames, user.Username)
+		}
+	}
+
+	ids := make(map[string]string)
+	if len(usernames) > 0 {
+		resp, err := c.GetUsersByUsernames(ctx, usernames)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, user := range resp.Data {
+			ids[strings.ToLower(user.Username)] = user.ID
+		}
+	}
+
+	var resolved []TimelineUser
+	var missing []string
+	for _, user := range users {
+		if user.ID == "" {
+			user.ID = ids[strings.ToLower(strings.TrimPrefix(user.Username, "@"))]
+		}
+		if user.ID == "" {
+			missing = append(missing, user.Username)
+			continue
+		}
+		resolved = append(resolved, user)
+	}
+
+	if len(missing) > 0 {
+		return resolved, fmt.Errorf("twitter: unknown users %s", strings.Join(missing, ", "))
+	}
+
+	return resolved, nil
+}
+
+// PollTimelines polls the timeline of each user every opts.Interval and
+// invokes callback for every new tweet, oldest first. Requests are paced by
+// the rate limiter of the client.
+//
+// PollTimelines returns ctx.Err() once ctx is cancelled, or an *HTTPError for
+// responses that retrying cannot fix (ErrUnauthorized, ErrForbidden).
+func (c *Client) PollTimelines(ctx context.Context, users []TimelineUser, params GetStreamQueryParams, opts PollOptions, callback func(tweet TweetResponse)) error {
+	log := opts.logger()
+	poller := c.newPoller(opts)
+
+	log.Infof("[twitter] polling %d user timelines every %s", len(users), opts.interval())
+
+	query := pollQueryParams(params)
+
+	return pollLoop(ctx, opts, func(ctx context.Context) error {
+		for _, user := range users {
+			path := fmt.Sprintf("/2/users/%s/tweets", user.ID)
+			err := poller.poll(ctx, path, query, "timeline:"+user.ID, user.Tag, callback)
+			switch {
+			case errors.Is(err, ErrRateLimited), errors.Is(err, ErrUnauthorized), errors.Is(err, ErrForbidden), ctx.Err() != nil:
+				return err
+			case err != nil:
+				// one failing timeline does not hold back the others
+				log.Warnf("[twitter] failed to poll the timeline of @%s: %v", user.Username, err)
+			}
+		}
+
+		return nil
+	})
+}
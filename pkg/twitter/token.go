@@ -0,0 +1,273 @@
+package twitter
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/its-rav/makima/pkg/config"
+)
+
+var (
+	// ErrInvalidTokenType is returned when oauth2/token answers with
+	// something else than a bearer token
+	ErrInvalidTokenType = errors.New("twitter: token type is not bearer")
+	// ErrStaticToken is returned when invalidating a pre-issued token
+	ErrStaticToken = errors.New("twitter: a pre-issued bearer token cannot be invalidated")
+	// ErrNoToken is returned when invalidating while no token was issued
+	ErrNoToken = errors.New("twitter: no bearer token to invalidate")
+)
+
+// TokenProvider supplies the bearer token used to authenticate requests
+type TokenProvider interface {
+	Token(ctx context.Context) (string, error)
+	// Invalidate revokes the current token, the next call to Token issues a new one
+	Invalidate(ctx context.Context) error
+}
+
+// TokenCache persists a bearer token between restarts, Load returns an empty
+// token when nothing is cached
+type TokenCache interface {
+	Load(ctx context.Context) (string, error)
+	Store(ctx context.Context, token string) error
+	Clear(ctx context.Context) error
+}
+
+// StaticToken is a pre-issued bearer token
+type StaticToken string
+
+func (t StaticToken) Token(ctx context.Context) (string, error) {
+	return string(t), nil
+}
+
+func (t StaticToken) Invalidate(ctx context.Context) error {
+	return ErrStaticToken
+}
+
+// OAuth2TokenProvider issues app-only bearer tokens with the consumer key and
+// secret, keeping the token in memory and in Cache when set
+type OAuth2TokenProvider struct {
+	Client         *Client
+	ConsumerKey    string
+	ConsumerSecret string
+	Cache          TokenCache
+
+	mu    sync.Mutex
+	token string
+}
+
+func (p *OAuth2TokenProvider) Token(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.token != "" {
+		return p.token, nil
+	}
+
+	if p.Cache != nil {
+		token, err := p.Cache.Load(ctx)
+		if err != nil {
+			return "", err
+		}
+		if token != "" {
+			p.token = token
+			return token, nil
+		}
+	}
+
+	token, err := p.Client.GetBearerToken(ctx, p.ConsumerKey, p.ConsumerSecret)
+	if err != nil {
+		return "", err
+	}
+
+	if p.Cache != nil {
+		if err := p.Cache.Store(ctx, token); err != nil {
+			return "", err
+		}
+	}
+	p.token = token
+
+	return token, nil
+}
+
+// Reset drops the token from memory and Cache without revoking it, used when
+// the API rejects a cached token
+func (p *OAuth2TokenProvider) Reset(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.token = ""
+	if p.Cache != nil {
+		return p.Cache.Clear(ctx)
+	}
+
+	return nil
+}
+
+// Invalidate revokes the token in memory or in Cache, failing with
+// ErrNoToken when there is none. The token is only dropped once revoked.
+func (p *OAuth2TokenProvider) Invalidate(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	token := p.token
+	if token == "" && p.Cache != nil {
+		cached, err := p.Cache.Load(ctx)
+		if err != nil {
+			return err
+		}
+		token = cached
+	}
+	if token == "" {
+		return ErrNoToken
+	}
+
+	if err := p.Client.InvalidateBearerToken(ctx, p.ConsumerKey, p.ConsumerSecret, token); err != nil {
+		return err
+	}
+
+	p.token = ""
+	if p.Cache != nil {
+		return p.Cache.Clear(ctx)
+	}
+
+	return nil
+}
+
+// NewTokenProvider returns the pre-issued token of cfg when set, otherwise a
+// provider issuing tokens with the consumer key and secret
+func NewTokenProvider(client *Client, cfg config.TwitterConfig, cache TokenCache) TokenProvider {
+	if cfg.BearerToken != "" {
+		return StaticToken(cfg.BearerToken)
+	}
+
+	return &OAuth2TokenProvider{
+		Client:         client,
+		ConsumerKey:    cfg.ConsumerKey,
+		ConsumerSecret: cfg.ConsumerSecret,
+		Cache:          cache,
+	}
+}
+
+// FileTokenCache keeps the bearer token in a file readable by the owner only
+type FileTokenCache string
+
+func (f FileTokenCache) Load(ctx context.Context) (string, error) {
+	bodyBytes, err := ioutil.ReadFile(string(f))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+
+	return strings.TrimSpace(string(bodyBytes)), err
+}
+
+func (f FileTokenCache) Store(ctx context.Context, token string) error {
+	if err := os.MkdirAll(filepath.Dir(string(f)), 0700); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(string(f), []byte(token), 0600)
+}
+
+func (f FileTokenCache) Clear(ctx context.Context) error {
+	err := os.Remove(string(f))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+type oauth2TokenResponse struct {
+	TokenType   string     `json:"token_type"`
+	AccessToken string     `json:"access_token"`
+	Errors      []APIError `json:"errors"`
+}
+
+// doOAuth2Request posts form to an oauth2 endpoint authenticated with the
+// consumer key and secret
+func (c *Client) doOAuth2Request(ctx context.Context, path string, consumerKey string, consumerSecret string, form url.Values) (oauth2TokenResponse, error) {
+	var authResp oauth2TokenResponse
+
+	keySecretConcat := fmt.Sprintf("%s:%s", url.QueryEscape(consumerKey), url.QueryEscape(consumerSecret))
+	b64Encoded := base64.StdEncoding.EncodeToString([]byte(keySecretConcat))
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.url(path), bytes.NewBufferString(form.Encode()))
+	if err != nil {
+		return authResp, err
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("Basic %s", b64Encoded))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded;charset=UTF-8")
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return authResp, err
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return authResp, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return authResp, newHTTPError(resp, bodyBytes)
+	}
+
+	if err := json.Unmarshal(bodyBytes, &authResp); err != nil {
+		return authResp, err
+	}
+
+	if len(authResp.Errors) > 0 {
+		return authResp, fmt.Errorf("twitter: %s", authResp.Errors[0].Title)
+	}
+
+	return authResp, nil
+}
+
+// GetBearerToken requests an app-only bearer token with the consumer key and secret
+func (c *Client) GetBearerToken(ctx context.Context, consumerKey string, consumerSecret string) (string, error) {
+	if consumerKey == "" || consumerSecret == "" {
+		return "", errors.New("twitter: consumer key and secret are required to request a bearer token")
+	}
+
+	authResp, err := c.doOAuth2Request(ctx, "/oauth2/token", consumerKey, consumerSecret, url.Values{
+		"grant_type": {"client_credentials"},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if !strings.EqualFold(authResp.TokenType, "bearer") {
+		return "", fmt.Errorf("%w: %q", ErrInvalidTokenType, authResp.TokenType)
+	}
+
+	if authResp.AccessToken == "" {
+		return "", errors.New("twitter: empty bearer token")
+	}
+
+	return authResp.AccessToken, nil
+}
+
+// InvalidateBearerToken revokes an app-only bearer token
+func (c *Client) InvalidateBearerToken(ctx context.Context, consumerKey string, consumerSecret string, token string) error {
+	_, err := c.doOAuth2Request(ctx, "/oauth2/invalidate_token", consumerKey, consumerSecret, url.Values{
+		"access_token": {token},
+	})
+
+	return err
+}
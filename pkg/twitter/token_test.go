@@ -0,0 +1,130 @@
+package twitter_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/its-rav/makima/pkg/twitter"
+	"github.com/its-rav/makima/pkg/twitter/twittertest"
+)
+
+// tokenServer is a fake server recording the revoked tokens, revoking fails
+// while failRevoke is set
+type tokenServer struct {
+	mu         sync.Mutex
+	issued     int
+	revoked    []string
+	failRevoke bool
+}
+
+func newTokenProvider(t *testing.T, s *tokenServer) *twitter.OAuth2TokenProvider {
+	t.Helper()
+
+	handler := twittertest.New(twittertest.Options{}).Handler()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		switch r.URL.Path {
+		case "/oauth2/token":
+			s.issued++
+		case "/oauth2/invalidate_token":
+			if s.failRevoke {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			s.revoked = append(s.revoked, r.FormValue("access_token"))
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	client := twitter.NewClient("")
+	client.BaseURL = server.URL
+
+	return &twitter.OAuth2TokenProvider{
+		Client:         client,
+		ConsumerKey:    "key",
+		ConsumerSecret: "secret",
+		Cache:          twitter.FileTokenCache(filepath.Join(t.TempDir(), "token")),
+	}
+}
+
+func TestOAuth2TokenProviderInvalidate(t *testing.T) {
+	ctx := context.Background()
+	server := &tokenServer{}
+	provider := newTokenProvider(t, server)
+
+	if err := provider.Invalidate(ctx); !errors.Is(err, twitter.ErrNoToken) {
+		t.Fatalf("Invalidate without a token returned %v, want ErrNoToken", err)
+	}
+	if server.issued != 0 {
+		t.Errorf("Invalidate issued %d tokens to revoke them", server.issued)
+	}
+
+	if _, err := provider.Token(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.Invalidate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{twittertest.DefaultBearerToken}; !reflect.DeepEqual(server.revoked, want) {
+		t.Errorf("revoked %v, want %v", server.revoked, want)
+	}
+
+	if cached, _ := provider.Cache.Load(ctx); cached != "" {
+		t.Errorf("cache holds %q after the token was revoked", cached)
+	}
+	if _, err := provider.Token(ctx); err != nil || server.issued != 2 {
+		t.Errorf("Token after Invalidate issued %d tokens in total and returned %v, want a new token", server.issued, err)
+	}
+}
+
+func TestOAuth2TokenProviderInvalidatesCachedToken(t *testing.T) {
+	ctx := context.Background()
+	server := &tokenServer{}
+	provider := newTokenProvider(t, server)
+	provider.Cache.Store(ctx, "cached-token")
+
+	if err := provider.Invalidate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"cached-token"}; !reflect.DeepEqual(server.revoked, want) || server.issued != 0 {
+		t.Errorf("revoked %v and issued %d tokens, want %v revoked only", server.revoked, server.issued, want)
+	}
+}
+
+func TestOAuth2TokenProviderKeepsTokenWhenRevokeFails(t *testing.T) {
+	ctx := context.Background()
+	server := &tokenServer{failRevoke: true}
+	provider := newTokenProvider(t, server)
+
+	token, err := provider.Token(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.Invalidate(ctx); err == nil {
+		t.Fatal("Invalidate succeeded while the revoke failed")
+	}
+
+	if cached, _ := provider.Cache.Load(ctx); cached != token {
+		t.Errorf("cache holds %q, want %q kept until it is revoked", cached, token)
+	}
+
+	server.mu.Lock()
+	server.failRevoke = false
+	server.mu.Unlock()
+	if err := provider.Invalidate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{token}; !reflect.DeepEqual(server.revoked, want) {
+		t.Errorf("revoked %v, want %v", server.revoked, want)
+	}
+}
@@ -0,0 +1,625 @@
+// Package twittertest implements an in-process stand-in for the Twitter v2
+// filtered stream, stream rules, recent search, user lookup, user timeline
+// and oauth2 endpoints.
+//
+// The server replays tweets from JSONL fixtures and can inject keep-alives,
+// disconnects, error statuses and malformed payloads on demand, either by
+// calling its methods or through the /fake/* admin endpoints.
+package twittertest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/its-rav/makima/pkg/twitter"
+)
+
+const (
+	DefaultBearerToken = "twittertest-token"
+	DefaultKeepAlive   = 20 * time.Second
+	DefaultInterval    = 1 * time.Second
+)
+
+// Options configures a fake server, zero values use the defaults
+type Options struct {
+	// BearerToken is issued by oauth2/token and required by the API endpoints
+	BearerToken string
+	// Tweets are replayed in order to every stream connection
+	Tweets [][]byte
+	// Interval is the delay between two replayed tweets
+	Interval time.Duration
+	// KeepAlive is the delay between two keep-alive newlines
+	KeepAlive time.Duration
+	// Loop restarts the replay once every tweet has been sent
+	Loop bool
+	// MaxRuleLength rejects longer rules, twitter.DefaultMaxRuleLength when zero
+	MaxRuleLength int
+}
+
+// streamConn is an open stream response
+type streamConn struct {
+	out  chan []byte
+	drop chan struct{}
+}
+
+// Server is a fake Twitter API, create it with NewServer or serve Handler
+type Server struct {
+	opts Options
+
+	mu             sync.Mutex
+	conns          map[*streamConn]struct{}
+	rules          []twitter.StreamRule
+	nextRuleID     int
+	failStatus     int
+	failCount      int
+	keepAlivePause bool
+	connections    int
+
+	// URL is set by NewServer and points to the running httptest server
+	URL    string
+	server *httptest.Server
+}
+
+// New returns a server that is not listening yet, see Handler
+func New(opts Options) *Server {
+	if opts.BearerToken == "" {
+		opts.BearerToken = DefaultBearerToken
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+	if opts.KeepAlive <= 0 {
+		opts.KeepAlive = DefaultKeepAlive
+	}
+	if opts.MaxRuleLength <= 0 {
+		opts.MaxRuleLength = twitter.DefaultMaxRuleLength
+	}
+
+	return &Server{
+		opts:       opts,
+		conns:      make(map[*streamConn]struct{}),
+		nextRuleID: 1,
+	}
+}
+
+// NewServer starts a fake server on a local port, call Close when done
+func NewServer(opts Options) *Server {
+	s := New(opts)
+	s.server = httptest.NewServer(s.Handler())
+	s.URL = s.server.URL
+
+	return s
+}
+
+// Close drops the open streams and stops the server started by NewServer
+func (s *Server) Close() {
+	s.Disconnect()
+	if s.server != nil {
+		s.server.Close()
+	}
+}
+
+// Client returns a twitter.Client pointing to the server
+func (s *Server) Client() *twitter.Client {
+	client := twitter.NewClient(s.opts.BearerToken)
+	client.BaseURL = s.URL
+
+	return client
+}
+
+// Handler serves the fake API
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth2/token", s.handleToken)
+	mux.HandleFunc("/oauth2/invalidate_token", s.handleInvalidateToken)
+	mux.HandleFunc("/2/tweets/search/stream", s.requireBearer(s.handleStream))
+	mux.HandleFunc("/2/tweets/search/stream/rules", s.requireBearer(s.handleRules))
+	mux.HandleFunc("/2/tweets/search/recent", s.requireBearer(s.handleSearch))
+	mux.HandleFunc("/2/users/by", s.requireBearer(s.handleUsersBy))
+	mux.HandleFunc("/2/users/", s.requireBearer(s.handleTimeline))
+	mux.HandleFunc("/fake/disconnect", s.handleAdmin(func(r *http.Request) { s.Disconnect() }))
+	mux.HandleFunc("/fake/malformed", s.handleAdmin(func(r *http.Request) { s.SendMalformed() }))
+	mux.HandleFunc("/fake/send", s.handleAdmin(func(r *http.Request) {
+		var buf bytes.Buffer
+		buf.ReadFrom(r.Body)
+		s.Send(buf.Bytes())
+	}))
+	mux.HandleFunc("/fake/fail", s.handleAdmin(func(r *http.Request) {
+		status, _ := strconv.Atoi(r.URL.Query().Get("status"))
+		count, _ := strconv.Atoi(r.URL.Query().Get("count"))
+		if count <= 0 {
+			count = 1
+		}
+		s.FailStream(status, count)
+	}))
+	mux.HandleFunc("/fake/keepalive", s.handleAdmin(func(r *http.Request) {
+		s.PauseKeepAlive(r.URL.Query().Get("pause") == "true")
+	}))
+
+	return mux
+}
+
+// Send writes a raw payload followed by a newline to every open stream
+func (s *Server) Send(raw []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for conn := range s.conns {
+		select {
+		case conn.out <- raw:
+		default:
+		}
+	}
+}
+
+// SendMalformed writes a truncated JSON payload to every open stream
+func (s *Server) SendMalformed() {
+	s.Send([]byte(`{"data":{"id":"1","text":"malformed`))
+}
+
+// Disconnect drops every open stream
+func (s *Server) Disconnect() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for conn := range s.conns {
+		close(conn.drop)
+		delete(s.conns, conn)
+	}
+}
+
+// FailStream answers the next count stream connections with status, a 429
+// carries x-rate-limit headers resetting a second later
+func (s *Server) FailStream(status int, count int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failStatus = status
+	s.failCount = count
+}
+
+// PauseKeepAlive stops or resumes the keep-alives, a paused stream with no
+// tweets to replay looks stalled to the client
+func (s *Server) PauseKeepAlive(pause bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keepAlivePause = pause
+}
+
+// Connections returns the number of stream connections accepted so far
+func (s *Server) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.connections
+}
+
+// Rules returns the active stream rules
+func (s *Server) Rules() []twitter.StreamRule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]twitter.StreamRule{}, s.rules...)
+}
+
+func (s *Server) requireBearer(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+s.opts.BearerToken {
+			writeProblem(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (s *Server) handleAdmin(action func(r *http.Request)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		action(r)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if _, _, ok := r.BasicAuth(); !ok || r.FormValue("grant_type") != "client_credentials" {
+		writeProblem(w, http.StatusForbidden, "Unable to verify your credentials")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"token_type":   "bearer",
+		"access_token": s.opts.BearerToken,
+	})
+}
+
+func (s *Server) handleInvalidateToken(w http.ResponseWriter, r *http.Request) {
+	if _, _, ok := r.BasicAuth(); !ok {
+		writeProblem(w, http.StatusForbidden, "Unable to verify your credentials")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{
+		"access_token": r.FormValue("access_token"),
+	})
+}
+
+// takeFailure returns the status the next stream connection fails with, 0
+// when it should succeed
+func (s *Server) takeFailure() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.connections++
+	if s.failCount <= 0 {
+		return 0
+	}
+	s.failCount--
+
+	return s.failStatus
+}
+
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	if status := s.takeFailure(); status != 0 {
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("x-rate-limit-limit", "50")
+			w.Header().Set("x-rate-limit-remaining", "0")
+			w.Header().Set("x-rate-limit-reset", strconv.FormatInt(time.Now().Add(time.Second).Unix(), 10))
+		}
+		writeProblem(w, status, http.StatusText(status))
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	conn := &streamConn{
+		out:  make(chan []byte, 16),
+		drop: make(chan struct{}),
+	}
+
+	s.mu.Lock()
+	s.conns[conn] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	replay := time.NewTicker(s.opts.Interval)
+	defer replay.Stop()
+	keepAlive := time.NewTicker(s.opts.KeepAlive)
+	defer keepAlive.Stop()
+
+	next := 0
+	for {
+		var payload []byte
+		select {
+		case <-r.Context().Done():
+			return
+		case <-conn.drop:
+			return
+		case payload = <-conn.out:
+		case <-replay.C:
+			if len(s.opts.Tweets) == 0 {
+				continue
+			}
+			if next >= len(s.opts.Tweets) {
+				if !s.opts.Loop {
+					continue
+				}
+				next = 0
+			}
+			payload = s.opts.Tweets[next]
+			next++
+		case <-keepAlive.C:
+			s.mu.Lock()
+			paused := s.keepAlivePause
+			s.mu.Unlock()
+			if paused {
+				continue
+			}
+		}
+
+		// payloads are shared by the connections, appending to them would race
+		line := make([]byte, 0, len(payload)+2)
+		line = append(append(line, payload...), '\r', '\n')
+		if _, err := w.Write(line); err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// handleSearch serves the fixtures as recent search results, every tweet
+// matches whatever the query
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	if status := s.takeFailure(); status != 0 {
+		writeProblem(w, status, http.StatusText(status))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.tweetsPage(r, func(tweet twitter.TweetResponse) bool { return true }))
+}
+
+// handleUsersBy resolves the authors of the fixtures by username
+func (s *Server) handleUsersBy(w http.ResponseWriter, r *http.Request) {
+	users := make(map[string]twitter.User)
+	for _, raw := range s.opts.Tweets {
+		var tweet twitter.TweetResponse
+		if err := json.Unmarshal(raw, &tweet); err != nil {
+			continue
+		}
+		for _, user := range tweet.Includes.Users {
+			users[strings.ToLower(user.Username)] = user
+		}
+	}
+
+	var resp twitter.UsersResponse
+	for _, username := range strings.Split(r.URL.Query().Get("usernames"), ",") {
+		user, ok := users[strings.ToLower(username)]
+		if !ok {
+			resp.Errors = append(resp.Errors, twitter.APIError{
+				Value:  username,
+				Detail: fmt.Sprintf("Could not find user with usernames: [%s].", username),
+				Title:  "Not Found Error",
+				Type:   "https://api.twitter.com/2/problems/resource-not-found",
+			})
+			continue
+		}
+		resp.Data = append(resp.Data, user)
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// handleTimeline serves the fixtures authored by the user as its timeline,
+// with the rate limit headers of the endpoint
+func (s *Server) handleTimeline(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/2/users/"), "/")
+	if len(parts) != 2 || parts[1] != "tweets" {
+		writeProblem(w, http.StatusNotFound, http.StatusText(http.StatusNotFound))
+		return
+	}
+
+	if status := s.takeFailure(); status != 0 {
+		writeProblem(w, status, http.StatusText(status))
+		return
+	}
+
+	w.Header().Set("x-rate-limit-limit", "1500")
+	w.Header().Set("x-rate-limit-remaining", "1499")
+	w.Header().Set("x-rate-limit-reset", strconv.FormatInt(time.Now().Add(15*time.Minute).Unix(), 10))
+
+	writeJSON(w, http.StatusOK, s.tweetsPage(r, func(tweet twitter.TweetResponse) bool {
+		return tweet.Data.AuthorID == parts[0]
+	}))
+}
+
+// tweetsPage pages through the fixtures matching keep, newest first, honouring
+// since_id, max_results and pagination_token
+func (s *Server) tweetsPage(r *http.Request, keep func(tweet twitter.TweetResponse) bool) twitter.TweetsResponse {
+	query := r.URL.Query()
+	sinceID := query.Get("since_id")
+	maxResults, _ := strconv.Atoi(query.Get("max_results"))
+	if maxResults <= 0 {
+		maxResults = 10
+	}
+	offset, _ := strconv.Atoi(query.Get("pagination_token"))
+
+	var matching []twitter.TweetResponse
+	for i := len(s.opts.Tweets) - 1; i >= 0; i-- {
+		var tweet twitter.TweetResponse
+		if err := json.Unmarshal(s.opts.Tweets[i], &tweet); err != nil || tweet.Data.TweetID == "" {
+			continue
+		}
+		if sinceID != "" && !newerID(tweet.Data.TweetID, sinceID) {
+			continue
+		}
+		if keep(tweet) {
+			matching = append(matching, tweet)
+		}
+	}
+
+	var page twitter.TweetsResponse
+	for i := offset; i < len(matching) && i < offset+maxResults; i++ {
+		page.Data = append(page.Data, matching[i].Data)
+		page.Includes.Users = append(page.Includes.Users, matching[i].Includes.Users...)
+		page.Includes.Media = append(page.Includes.Media, matching[i].Includes.Media...)
+		page.Includes.Tweets = append(page.Includes.Tweets, matching[i].Includes.Tweets...)
+		page.Includes.Polls = append(page.Includes.Polls, matching[i].Includes.Polls...)
+		page.Includes.Places = append(page.Includes.Places, matching[i].Includes.Places...)
+	}
+
+	page.Meta.ResultCount = len(page.Data)
+	if len(page.Data) > 0 {
+		page.Meta.NewestID = page.Data[0].TweetID
+		page.Meta.OldestID = page.Data[len(page.Data)-1].TweetID
+	}
+	if offset+maxResults < len(matching) {
+		page.Meta.NextToken = strconv.Itoa(offset + maxResults)
+	}
+
+	return page
+}
+
+// newerID compares snowflake IDs without overflowing
+func newerID(id string, than string) bool {
+	if len(id) != len(than) {
+		return len(id) > len(than)
+	}
+
+	return id > than
+}
+
+func (s *Server) handleRules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		rules := s.Rules()
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"data": rules,
+			"meta": map[string]interface{}{
+				"sent":         time.Now().UTC().Format(time.RFC3339),
+				"result_count": len(rules),
+			},
+		})
+	case http.MethodPost:
+		var req struct {
+			Add    []twitter.AddStreamRule          `json:"add"`
+			Delete *twitter.DeleteStreamRulesAction `json:"delete"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeProblem(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		dryRun := r.URL.Query().Get("dry_run") == "true"
+		if req.Delete != nil {
+			writeJSON(w, http.StatusOK, s.deleteRules(req.Delete.Ids, dryRun))
+			return
+		}
+		writeJSON(w, http.StatusOK, s.addRules(req.Add, dryRun))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) addRules(add []twitter.AddStreamRule, dryRun bool) twitter.CommandStreamRulesResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var resp twitter.CommandStreamRulesResponse
+	resp.Meta.Sent = time.Now().UTC().Format(time.RFC3339)
+
+	for _, rule := range add {
+		if apiErr := s.validateRule(rule); apiErr != nil {
+			resp.Errors = append(resp.Errors, *apiErr)
+			resp.Meta.Summary.Invalid++
+			resp.Meta.Summary.NotCreated++
+			continue
+		}
+
+		resp.Meta.Summary.Valid++
+		created := twitter.StreamRule{
+			ID:    strconv.Itoa(s.nextRuleID),
+			Value: rule.Value,
+			Tag:   rule.Tag,
+		}
+		if !dryRun {
+			s.nextRuleID++
+			s.rules = append(s.rules, created)
+			resp.Meta.Summary.Created++
+		}
+		resp.Data = append(resp.Data, created)
+	}
+
+	return resp
+}
+
+// validateRule must be called with s.mu held
+func (s *Server) validateRule(rule twitter.AddStreamRule) *twitter.APIError {
+	switch {
+	case strings.TrimSpace(rule.Value) == "":
+		return &twitter.APIError{Title: "InvalidRule", Value: rule.Value, Detail: "empty rule"}
+	case utf8.RuneCountInString(rule.Value) > s.opts.MaxRuleLength:
+		return &twitter.APIError{Title: "RuleLengthExceeded", Value: rule.Value, Detail: fmt.Sprintf("rule is longer than %d characters", s.opts.MaxRuleLength)}
+	}
+
+	for _, existing := range s.rules {
+		if existing.Value == rule.Value {
+			return &twitter.APIError{Title: "DuplicateRule", Value: rule.Value, ID: existing.ID}
+		}
+	}
+
+	return nil
+}
+
+func (s *Server) deleteRules(ids []string, dryRun bool) twitter.CommandStreamRulesResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var resp twitter.CommandStreamRulesResponse
+	resp.Meta.Sent = time.Now().UTC().Format(time.RFC3339)
+
+	for _, id := range ids {
+		index := -1
+		for i, rule := range s.rules {
+			if rule.ID == id {
+				index = i
+				break
+			}
+		}
+
+		if index < 0 {
+			resp.Errors = append(resp.Errors, twitter.APIError{Title: "RuleNotFound", ID: id})
+			resp.Meta.Summary.NotDeleted++
+			continue
+		}
+
+		if !dryRun {
+			s.rules = append(s.rules[:index], s.rules[index+1:]...)
+		}
+		resp.Meta.Summary.Deleted++
+	}
+
+	return resp
+}
+
+// LoadFixtures reads one raw stream payload per non-empty line of a JSONL file
+func LoadFixtures(fileName string) ([][]byte, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var tweets [][]byte
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		tweets = append(tweets, append([]byte{}, line...))
+	}
+
+	return tweets, scanner.Err()
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeProblem(w http.ResponseWriter, status int, title string) {
+	writeJSON(w, status, map[string]interface{}{
+		"title":  title,
+		"type":   "about:blank",
+		"status": status,
+		"detail": title,
+	})
+}
@@ -2,11 +2,43 @@ package twitter
 
 import "encoding/json"
 
+// APIVersion is the version of the Twitter API modelled by the types below,
+// every field selectable with the tweet, user, media, poll and place fields
+// query parameters has a counterpart
+const APIVersion = "2"
+
+type UserPublicMetrics struct {
+	FollowersCount int `json:"followers_count"`
+	FollowingCount int `json:"following_count"`
+	TweetCount     int `json:"tweet_count"`
+	ListedCount    int `json:"listed_count"`
+}
+
+type UserURLEntity struct {
+	Urls []EntityURL `json:"urls,omitempty"`
+}
+
+type UserEntities struct {
+	URL         *UserURLEntity `json:"url,omitempty"`
+	Description *Entity        `json:"description,omitempty"`
+}
+
 type User struct {
-	ID              string `json:"id"`
-	Name            string `json:"name"`
-	Username        string `json:"username"`
-	ProfileImageURL string `json:"profile_image_url"`
+	ID              string             `json:"id"`
+	Name            string             `json:"name"`
+	Username        string             `json:"username"`
+	ProfileImageURL string             `json:"profile_image_url"`
+	CreatedAt       string             `json:"created_at,omitempty"`
+	Description     string             `json:"description,omitempty"`
+	Entities        *UserEntities      `json:"entities,omitempty"`
+	Location        string             `json:"location,omitempty"`
+	PinnedTweetID   string             `json:"pinned_tweet_id,omitempty"`
+	Protected       bool               `json:"protected"`
+	PublicMetrics   *UserPublicMetrics `json:"public_metrics,omitempty"`
+	URL             string             `json:"url,omitempty"`
+	Verified        bool               `json:"verified"`
+	VerifiedType    string             `json:"verified_type,omitempty"`
+	Withheld        *Withheld          `json:"withheld,omitempty"`
 }
 
 type Domain struct {
@@ -47,9 +79,10 @@ type EntityURL struct {
 	UnwoundURL  string     `json:"unwound_url"`
 	MediaKey    string     `json:"media_key"`
 	Images      []URLImage `json:"images"`
-	End         int        `json:"end"`   // end index of the URL in the Tweet text
-	Start       int        `json:"start"` // start index of the URL in the Tweet text
-	URL         string     `json:"url"`   // URL
+	Status      int        `json:"status,omitempty"` // HTTP status of the unwound URL
+	End         int        `json:"end"`              // end index of the URL in the Tweet text
+	Start       int        `json:"start"`            // start index of the URL in the Tweet text
+	URL         string     `json:"url"`              // URL
 }
 
 type EntityAnnotation struct {
@@ -66,36 +99,292 @@ type CashTag struct {
 	Tag   string `json:"tag"`
 }
 
+type HashTag struct {
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+	Tag   string `json:"tag"`
+}
+
+type Mention struct {
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+	Username string `json:"username"`
+	ID       string `json:"id"`
+}
+
 type Entity struct {
 	Annotations []EntityAnnotation `json:"annotations"`
 	Urls        []EntityURL        `json:"urls"`
 	CashTags    []CashTag          `json:"cashtags"`
+	HashTags    []HashTag          `json:"hashtags,omitempty"`
+	Mentions    []Mention          `json:"mentions"`
 }
 
+// MediaVariant is one encoding of a video or animated GIF
+type MediaVariant struct {
+	BitRate     int    `json:"bit_rate"`
+	ContentType string `json:"content_type"`
+	URL         string `json:"url"`
+}
+
+type MediaPublicMetrics struct {
+	ViewCount int `json:"view_count"`
+}
+
+// MediaPlaybackMetrics are the non public, organic and promoted metrics of a video
+type MediaPlaybackMetrics struct {
+	Playback0Count   int `json:"playback_0_count"`
+	Playback25Count  int `json:"playback_25_count"`
+	Playback50Count  int `json:"playback_50_count"`
+	Playback75Count  int `json:"playback_75_count"`
+	Playback100Count int `json:"playback_100_count"`
+	ViewCount        int `json:"view_count,omitempty"`
+}
+
+// types of Media
+const (
+	MediaPhoto       = "photo"
+	MediaVideo       = "video"
+	MediaAnimatedGIF = "animated_gif"
+)
+
 type Media struct {
-	MediaKey string `json:"media_key"`
-	Type     string `json:"type"`
-	URL      string `json:"url"`
+	MediaKey         string                `json:"media_key"`
+	Type             string                `json:"type"`
+	URL              string                `json:"url"`
+	DurationMS       int                   `json:"duration_ms,omitempty"`
+	Height           int                   `json:"height,omitempty"`
+	Width            int                   `json:"width,omitempty"`
+	PreviewImageURL  string                `json:"preview_image_url,omitempty"`
+	AltText          string                `json:"alt_text,omitempty"`
+	Variants         []MediaVariant        `json:"variants,omitempty"`
+	PublicMetrics    *MediaPublicMetrics   `json:"public_metrics,omitempty"`
+	NonPublicMetrics *MediaPlaybackMetrics `json:"non_public_metrics,omitempty"`
+	OrganicMetrics   *MediaPlaybackMetrics `json:"organic_metrics,omitempty"`
+	PromotedMetrics  *MediaPlaybackMetrics `json:"promoted_metrics,omitempty"`
+}
+
+type PollOption struct {
+	Position int    `json:"position"`
+	Label    string `json:"label"`
+	Votes    int    `json:"votes"`
+}
+
+type Poll struct {
+	ID              string       `json:"id"`
+	Options         []PollOption `json:"options"`
+	DurationMinutes int          `json:"duration_minutes,omitempty"`
+	EndDatetime     string       `json:"end_datetime,omitempty"`
+	VotingStatus    string       `json:"voting_status,omitempty"`
+}
+
+// PlaceGeo is a GeoJSON feature with the bounding box of a place
+type PlaceGeo struct {
+	Type       string                 `json:"type"`
+	BBox       []float64              `json:"bbox"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type Place struct {
+	ID              string    `json:"id"`
+	FullName        string    `json:"full_name"`
+	Name            string    `json:"name,omitempty"`
+	Country         string    `json:"country,omitempty"`
+	CountryCode     string    `json:"country_code,omitempty"`
+	PlaceType       string    `json:"place_type,omitempty"`
+	ContainedWithin []string  `json:"contained_within,omitempty"`
+	Geo             *PlaceGeo `json:"geo,omitempty"`
 }
 
 type TweetInclude struct {
-	Users []User  `json:"users"`
-	Media []Media `json:"media"`
+	Users  []User      `json:"users"`
+	Media  []Media     `json:"media"`
+	Tweets []TweetData `json:"tweets"`
+	Polls  []Poll      `json:"polls,omitempty"`
+	Places []Place     `json:"places,omitempty"`
+}
+
+// types of ReferencedTweet
+const (
+	ReferencedTweetQuoted    = "quoted"
+	ReferencedTweetRepliedTo = "replied_to"
+	ReferencedTweetRetweeted = "retweeted"
+)
+
+type ReferencedTweet struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+type Attachments struct {
+	MediaKeys []string `json:"media_keys,omitempty"`
+	PollIDs   []string `json:"poll_ids,omitempty"`
+}
+
+type GeoCoordinates struct {
+	Type        string    `json:"type"`
+	Coordinates []float64 `json:"coordinates"`
+}
+
+type TweetGeo struct {
+	Coordinates *GeoCoordinates `json:"coordinates,omitempty"`
+	PlaceID     string          `json:"place_id,omitempty"`
+}
+
+type TweetPublicMetrics struct {
+	RetweetCount    int `json:"retweet_count"`
+	ReplyCount      int `json:"reply_count"`
+	LikeCount       int `json:"like_count"`
+	QuoteCount      int `json:"quote_count"`
+	BookmarkCount   int `json:"bookmark_count,omitempty"`
+	ImpressionCount int `json:"impression_count,omitempty"`
+}
+
+// TweetEngagementMetrics are the non public, organic and promoted metrics of
+// a tweet, only available with user context authentication
+type TweetEngagementMetrics struct {
+	ImpressionCount   int `json:"impression_count"`
+	LikeCount         int `json:"like_count,omitempty"`
+	ReplyCount        int `json:"reply_count,omitempty"`
+	RetweetCount      int `json:"retweet_count,omitempty"`
+	URLLinkClicks     int `json:"url_link_clicks,omitempty"`
+	UserProfileClicks int `json:"user_profile_clicks,omitempty"`
+}
+
+type Withheld struct {
+	Copyright    bool     `json:"copyright"`
+	CountryCodes []string `json:"country_codes"`
+	Scope        string   `json:"scope,omitempty"`
+}
+
+type EditControls struct {
+	EditsRemaining int    `json:"edits_remaining"`
+	IsEditEligible bool   `json:"is_edit_eligible"`
+	EditableUntil  string `json:"editable_until"`
 }
 
 type TweetData struct {
-	PossiblySentitive   bool                `json:"possibly_sensitive"`
-	Content             string              `json:"text"`
-	TweetID             string              `json:"id"`
-	CreatedAt           string              `json:"created_at"`
-	EditHistoryTweetIDs []string            `json:"edit_history_tweet_ids"`
-	ContextAnnotations  []ContextAnnotation `json:"context_annotations"`
-	Entities            Entity              `json:"entities"`
+	PossiblySentitive   bool                    `json:"possibly_sensitive"`
+	Content             string                  `json:"text"`
+	TweetID             string                  `json:"id"`
+	AuthorID            string                  `json:"author_id"`
+	InReplyToUserID     string                  `json:"in_reply_to_user_id"`
+	ConversationID      string                  `json:"conversation_id,omitempty"`
+	CreatedAt           string                  `json:"created_at"`
+	Lang                string                  `json:"lang,omitempty"`
+	Source              string                  `json:"source,omitempty"`
+	ReplySettings       string                  `json:"reply_settings,omitempty"`
+	EditHistoryTweetIDs []string                `json:"edit_history_tweet_ids"`
+	EditControls        *EditControls           `json:"edit_controls,omitempty"`
+	ReferencedTweets    []ReferencedTweet       `json:"referenced_tweets"`
+	Attachments         *Attachments            `json:"attachments,omitempty"`
+	Geo                 *TweetGeo               `json:"geo,omitempty"`
+	ContextAnnotations  []ContextAnnotation     `json:"context_annotations"`
+	Entities            Entity                  `json:"entities"`
+	PublicMetrics       *TweetPublicMetrics     `json:"public_metrics,omitempty"`
+	NonPublicMetrics    *TweetEngagementMetrics `json:"non_public_metrics,omitempty"`
+	OrganicMetrics      *TweetEngagementMetrics `json:"organic_metrics,omitempty"`
+	PromotedMetrics     *TweetEngagementMetrics `json:"promoted_metrics,omitempty"`
+	Withheld            *Withheld               `json:"withheld,omitempty"`
+}
+
+// MatchingRule is a stream rule the tweet matched
+type MatchingRule struct {
+	ID  string `json:"id"`
+	Tag string `json:"tag"`
 }
 
+// ExtraRuleTags is the PublishMessage.Extras key holding the comma separated
+// tags of the rules a tweet matched
+const ExtraRuleTags = "ruleTags"
+
 type TweetResponse struct {
-	Data     TweetData    `json:"data"`
-	Includes TweetInclude `json:"includes"`
+	Data          TweetData      `json:"data"`
+	Includes      TweetInclude   `json:"includes"`
+	MatchingRules []MatchingRule `json:"matching_rules,omitempty"`
+	// Errors are partial errors, e.g. an expanded tweet that is not available
+	Errors []APIError `json:"errors,omitempty"`
+}
+
+// OriginalID returns the ID of the first version of the tweet, shared by all
+// of its edits
+func (t TweetData) OriginalID() string {
+	if len(t.EditHistoryTweetIDs) > 0 {
+		return t.EditHistoryTweetIDs[0]
+	}
+
+	return t.TweetID
+}
+
+// IsEdit reports whether the tweet is an edited version of an earlier one
+func (t TweetData) IsEdit() bool {
+	return t.OriginalID() != t.TweetID
+}
+
+// Supersedes reports whether the tweet is a later version of tweet id,
+// edit_history_tweet_ids lists the versions up to this one oldest first
+func (t TweetData) Supersedes(id string) bool {
+	for _, versionID := range t.EditHistoryTweetIDs {
+		if versionID == t.TweetID {
+			return false
+		}
+		if versionID == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+// UserByID looks up an expanded user
+func (resp *TweetResponse) UserByID(id string) (User, bool) {
+	for _, user := range resp.Includes.Users {
+		if user.ID == id {
+			return user, true
+		}
+	}
+
+	return User{}, false
+}
+
+// TweetByID looks up an expanded referenced tweet
+func (resp *TweetResponse) TweetByID(id string) (TweetData, bool) {
+	for _, tweet := range resp.Includes.Tweets {
+		if tweet.TweetID == id {
+			return tweet, true
+		}
+	}
+
+	return TweetData{}, false
+}
+
+// Author returns the expanded author of the tweet, falling back to the first
+// expanded user when author_id was not requested
+func (resp *TweetResponse) Author() (User, bool) {
+	if author, ok := resp.UserByID(resp.Data.AuthorID); ok {
+		return author, true
+	}
+
+	if resp.Data.AuthorID == "" && len(resp.Includes.Users) > 0 {
+		return resp.Includes.Users[0], true
+	}
+
+	return User{}, false
+}
+
+// RuleTags returns the distinct non-empty tags of the matching rules
+func (resp *TweetResponse) RuleTags() []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, rule := range resp.MatchingRules {
+		if rule.Tag == "" || seen[rule.Tag] {
+			continue
+		}
+		seen[rule.Tag] = true
+		tags = append(tags, rule.Tag)
+	}
+
+	return tags
 }
 
 func (resp *TweetResponse) ParseFrom(raw []byte) {
@@ -113,6 +402,7 @@ func (resp *TweetResponse) ParseFrom(raw []byte) {
 type StreamRule struct {
 	ID    string `json:"id"`
 	Value string `json:"value"`
+	Tag   string `json:"tag,omitempty"`
 }
 
 type GetStreamRulesResponse struct {
@@ -140,22 +430,46 @@ type DeleteStreamRulesRequest struct {
 	Delete DeleteStreamRulesAction `json:"delete"`
 }
 
+// APIError is an entry of the "errors" array returned by the v2 endpoints
+type APIError struct {
+	Title  string `json:"title"`
+	Type   string `json:"type"`
+	Detail string `json:"detail"`
+	Value  string `json:"value,omitempty"`
+	ID     string `json:"id,omitempty"`
+	// the parameter and resource a partial error is about
+	Parameter    string `json:"parameter,omitempty"`
+	ResourceType string `json:"resource_type,omitempty"`
+	ResourceID   string `json:"resource_id,omitempty"`
+	// set on the stream error objects
+	DisconnectType  string `json:"disconnect_type,omitempty"`
+	ConnectionIssue string `json:"connection_issue,omitempty"`
+}
+
+type CommandStreamRulesSummary struct {
+	Created    int `json:"created"`
+	NotCreated int `json:"not_created"`
+	Valid      int `json:"valid"`
+	Invalid    int `json:"invalid"`
+	Deleted    int `json:"deleted"`
+	NotDeleted int `json:"not_deleted"`
+}
+
 type CommandStreamRulesResponse struct {
-	ID    string `json:"id"`
-	Value string `json:"value"`
-	Tag   string `json:"tag"`
-	Meta  struct {
-		Sent    string                 `json:"sent"`
-		Summary map[string]interface{} `json:"summary"`
+	Data   []StreamRule `json:"data"`
+	Errors []APIError   `json:"errors"`
+	Meta   struct {
+		Sent    string                    `json:"sent"`
+		Summary CommandStreamRulesSummary `json:"summary"`
 	} `json:"meta"`
 }
 
-// tweet.fields: attachments, author_id, context_annotations, conversation_id, created_at, entities, geo, id, in_reply_to_user_id, lang, non_public_metrics, organic_metrics, possibly_sensitive, promoted_metrics, public_metrics, referenced_tweets, reply_settings, source, text, withheld
-// user.fields: created_at, description, entities, id, location, name, pinned_tweet_id, profile_image_url, protected, public_metrics, url, username, verified, withheld
-// media.fields: duration_ms, height, media_key, preview_image_url, type, url, width, public_metrics, non_public_metrics, organic_metrics, promoted_metricPrintjson
+// tweet.fields: attachments, author_id, context_annotations, conversation_id, created_at, edit_controls, entities, geo, id, in_reply_to_user_id, lang, non_public_metrics, organic_metrics, possibly_sensitive, promoted_metrics, public_metrics, referenced_tweets, reply_settings, source, text, withheld
+// user.fields: created_at, description, entities, id, location, name, pinned_tweet_id, profile_image_url, protected, public_metrics, url, username, verified, verified_type, withheld
+// media.fields: alt_text, duration_ms, height, media_key, preview_image_url, type, url, variants, width, public_metrics, non_public_metrics, organic_metrics, promoted_metrics
 // poll.fields: duration_minutes, end_datetime, id, options, voting_status
 // place.fields: contained_within, country, country_code, full_name, geo, id, name, place_type
-// expansions: author_id, entities.mentions.username, geo.place_id, in_reply_to_user_id, referenced_tweets.id, referenced_tweets.id.author_id
+// expansions: attachments.media_keys, attachments.poll_ids, author_id, edit_history_tweet_ids, entities.mentions.username, geo.place_id, in_reply_to_user_id, referenced_tweets.id, referenced_tweets.id.author_id
 
 type GetStreamQueryParams struct {
 	Expansions      []string `paramName:"expansions"`
@@ -168,3 +482,16 @@ type GetStreamQueryParams struct {
 	PollFields      []string `paramName:"poll.fields"`
 	PlaceFields     []string `paramName:"place.fields"`
 }
+
+// DefaultStreamQueryParams selects every field available with app-only
+// authentication, the metrics needing user context are left out
+func DefaultStreamQueryParams() GetStreamQueryParams {
+	return GetStreamQueryParams{
+		TweetFields: []string{"attachments", "author_id", "context_annotations", "conversation_id", "created_at", "edit_controls", "entities", "geo", "in_reply_to_user_id", "lang", "possibly_sensitive", "public_metrics", "referenced_tweets", "reply_settings", "source", "withheld"},
+		Expansions:  []string{"author_id", "attachments.media_keys", "attachments.poll_ids", "geo.place_id", "referenced_tweets.id", "referenced_tweets.id.author_id", "in_reply_to_user_id", "entities.mentions.username"},
+		UserFields:  []string{"created_at", "description", "entities", "location", "name", "pinned_tweet_id", "profile_image_url", "protected", "public_metrics", "url", "username", "verified", "verified_type", "withheld"},
+		MediaFields: []string{"alt_text", "duration_ms", "height", "preview_image_url", "public_metrics", "type", "url", "variants", "width"},
+		PollFields:  []string{"duration_minutes", "end_datetime", "options", "voting_status"},
+		PlaceFields: []string{"contained_within", "country", "country_code", "full_name", "geo", "name", "place_type"},
+	}
+}
@@ -0,0 +1,134 @@
+package twitter
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// readFixtures returns the lines of a JSONL fixture file
+func readFixtures(t *testing.T, path string) [][]byte {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var lines [][]byte
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1<<20), 1<<20)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) > 0 {
+			lines = append(lines, append([]byte(nil), scanner.Bytes()...))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	return lines
+}
+
+// assertSubset fails for every value of want missing from got, fields
+// added with their zero value by the encoding are allowed
+func assertSubset(t *testing.T, path string, want interface{}, got interface{}) {
+	t.Helper()
+
+	switch want := want.(type) {
+	case map[string]interface{}:
+		gotMap, ok := got.(map[string]interface{})
+		if !ok {
+			t.Errorf("%s: got %v, want an object", path, got)
+			return
+		}
+		for key, value := range want {
+			gotValue, ok := gotMap[key]
+			if !ok {
+				t.Errorf("%s.%s: missing after the round trip, want %v", path, key, value)
+				continue
+			}
+			assertSubset(t, path+"."+key, value, gotValue)
+		}
+	case []interface{}:
+		gotSlice, ok := got.([]interface{})
+		if !ok || len(gotSlice) != len(want) {
+			t.Errorf("%s: got %v, want %v", path, got, want)
+			return
+		}
+		for i := range want {
+			assertSubset(t, fmt.Sprintf("%s[%d]", path, i), want[i], gotSlice[i])
+		}
+	default:
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("%s: got %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestTweetResponseRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+	}{
+		{name: "stream", path: "twittertest/testdata/tweets.jsonl"},
+		{name: "payloads", path: "testdata/payloads.jsonl"},
+	}
+
+	for _, tt := range tests {
+		for i, line := range readFixtures(t, tt.path) {
+			t.Run(fmt.Sprintf("%s/%d", tt.name, i+1), func(t *testing.T) {
+				var tweet TweetResponse
+				if err := json.Unmarshal(line, &tweet); err != nil {
+					t.Fatalf("decode: %v", err)
+				}
+
+				encoded, err := json.Marshal(tweet)
+				if err != nil {
+					t.Fatalf("encode: %v", err)
+				}
+
+				var want, got interface{}
+				if err := json.Unmarshal(line, &want); err != nil {
+					t.Fatal(err)
+				}
+				if err := json.Unmarshal(encoded, &got); err != nil {
+					t.Fatal(err)
+				}
+				assertSubset(t, "$", want, got)
+
+				var decoded TweetResponse
+				if err := json.Unmarshal(encoded, &decoded); err != nil {
+					t.Fatalf("decode again: %v", err)
+				}
+				if !reflect.DeepEqual(tweet, decoded) {
+					t.Errorf("decoded again:\n%+v\nwant:\n%+v", decoded, tweet)
+				}
+			})
+		}
+	}
+}
+
+func TestTweetDataSupersedes(t *testing.T) {
+	tests := []struct {
+		tweet TweetData
+		id    string
+		want  bool
+	}{
+		{tweet: TweetData{TweetID: "3", EditHistoryTweetIDs: []string{"1", "2", "3"}}, id: "1", want: true},
+		{tweet: TweetData{TweetID: "3", EditHistoryTweetIDs: []string{"1", "2", "3"}}, id: "2", want: true},
+		{tweet: TweetData{TweetID: "3", EditHistoryTweetIDs: []string{"1", "2", "3"}}, id: "3", want: false},
+		{tweet: TweetData{TweetID: "2", EditHistoryTweetIDs: []string{"1", "2"}}, id: "3", want: false},
+		{tweet: TweetData{TweetID: "1"}, id: "1", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.tweet.Supersedes(tt.id); got != tt.want {
+			t.Errorf("tweet %s with history %v supersedes %s: got %t, want %t", tt.tweet.TweetID, tt.tweet.EditHistoryTweetIDs, tt.id, got, tt.want)
+		}
+	}
+}